@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Replacement of secret values when the configuration is printed.
+const redacted = "<redacted>"
+
+// Options never printed in clear.
+var secretOptions = map[string]bool{
+	"wallix-password": true,
+	"wallix-api-key":  true,
+	"vault-token":     true,
+}
+
+// Print the effective configuration with secrets redacted followed by the validation result.
+// It returns the exit code of the check, not zero if the configuration is invalid.
+func Check(w io.Writer, config Config, validationErr error) int {
+	content, err := yaml.Marshal(settings(reflect.ValueOf(config)))
+	if err != nil {
+		fmt.Fprintf(w, "cannot print configuration: %v\n", err)
+
+		return 1
+	}
+	fmt.Fprintf(w, "%s\n", content)
+
+	if validationErr != nil {
+		fmt.Fprintln(w, validationErr)
+
+		return 1
+	}
+	fmt.Fprintln(w, "configuration is valid")
+
+	return 0
+}
+
+// Convert the configuration to a map keyed by option names with secrets redacted.
+func settings(value reflect.Value) interface{} {
+	switch value.Kind() { //nolint:exhaustive
+	case reflect.Struct:
+		options := yaml.MapSlice{}
+		for i := 0; i < value.NumField(); i++ {
+			name := value.Type().Field(i).Tag.Get("mapstructure")
+			if name == "" {
+				continue
+			}
+			option := settings(value.Field(i))
+			if secretOptions[name] && !value.Field(i).IsZero() {
+				option = redacted
+			}
+			options = append(options, yaml.MapItem{Key: name, Value: option})
+		}
+
+		return options
+	case reflect.Map:
+		options := map[string]interface{}{}
+		for _, key := range value.MapKeys() {
+			options[fmt.Sprint(key.Interface())] = settings(value.MapIndex(key))
+		}
+
+		return options
+	default:
+		return value.Interface()
+	}
+}
@@ -2,43 +2,144 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"path"
 	"strings"
 
+	"github.com/prometheus/common/promlog"
+	"github.com/prometheus/common/version"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
 const (
-	defaultTimeout = 10
+	defaultTimeout                = 10
+	defaultSessionsClosedWindow   = 300
+	defaultSessionsBreakdownLimit = 20
+	// Name of the program in version information.
+	ProgramName = "wallix_bastion_exporter"
+	// Name of the module used by the probe endpoint when none is requested.
+	DefaultModule = "default"
+	// Modes to determine the timeframe over which closed sessions are counted.
+	SessionsClosedWindowFixed         = "fixed"
+	SessionsClosedWindowScrapeTimeout = "scrape-timeout"
+	SessionsClosedWindowLastScrape    = "last-scrape"
+)
+
+var (
+	// Directories where the config file is searched if not given explicitly, in order.
+	configPaths = []string{".", "/etc/wallix_bastion_exporter/"}
+	// Upper bounds in seconds of the closed sessions duration histogram buckets, from 1m to 1d.
+	defaultSessionsDurationBuckets = []int{60, 300, 900, 1800, 3600, 7200, 14400, 28800, 86400}
+	// Thresholds in seconds to count long running sessions, 8h and 1d.
+	defaultSessionsAgeThresholds = []int{28800, 86400}
 )
 
 // All configuration available for the user.
 type Config struct {
-	ListenAddress  string `mapstructure:"listen-address"`
-	TelemetryPath  string `mapstructure:"telemetry-path"`
-	ScrapeURI      string `mapstructure:"scrape-uri"`
-	SkipVerify     bool   `mapstructure:"skip-verify"`
-	Timeout        int    `mapstructure:"timeout"`
-	WallixUsername string `mapstructure:"wallix-username"`
-	WallixPassword string `mapstructure:"wallix-password"`
+	ListenAddress            string            `mapstructure:"listen-address"`
+	WebConfigFile            string            `mapstructure:"web.config.file"`
+	LogLevel                 string            `mapstructure:"log.level"`
+	LogFormat                string            `mapstructure:"log.format"`
+	TelemetryPath            string            `mapstructure:"telemetry-path"`
+	ScrapeURI                string            `mapstructure:"scrape-uri"`
+	APIVersion               string            `mapstructure:"api-version"`
+	SkipVerify               bool              `mapstructure:"skip-verify"`
+	CAFile                   string            `mapstructure:"ca-file"`
+	CertFile                 string            `mapstructure:"cert-file"`
+	KeyFile                  string            `mapstructure:"key-file"`
+	ServerName               string            `mapstructure:"server-name"`
+	TLSMinVersion            string            `mapstructure:"tls-min-version"`
+	Timeout                  int               `mapstructure:"timeout"`
+	RefreshInterval          int               `mapstructure:"refresh-interval"`
+	SessionsClosedWindow     int               `mapstructure:"sessions-closed-window"`
+	SessionsClosedWindowMode string            `mapstructure:"sessions-closed-window-mode"`
+	SessionsStateFile        string            `mapstructure:"sessions-state-file"`
+	SessionsByDevice         bool              `mapstructure:"sessions-by-device"`
+	SessionsByUserGroup      bool              `mapstructure:"sessions-by-user-group"`
+	SessionsBreakdownLimit   int               `mapstructure:"sessions-breakdown-limit"`
+	SessionsDurationBuckets  []int             `mapstructure:"sessions-duration-buckets"`
+	SessionsAgeThresholds    []int             `mapstructure:"sessions-age-thresholds"`
+	SessionsAgeByTarget      bool              `mapstructure:"sessions-age-by-target"`
+	WallixUsername           string            `mapstructure:"wallix-username"`
+	WallixPassword           string            `mapstructure:"wallix-password"`
+	WallixPasswordFile       string            `mapstructure:"wallix-password-file"`
+	WallixAPIKey             string            `mapstructure:"wallix-api-key"`
+	VaultAddr                string            `mapstructure:"vault-addr"`
+	VaultToken               string            `mapstructure:"vault-token"`
+	VaultPath                string            `mapstructure:"vault-path"`
+	VaultField               string            `mapstructure:"vault-field"`
+	Modules                  map[string]Module `mapstructure:"modules"`
+	Collectors               map[string]bool   `mapstructure:"collector"`
+}
+
+// Settings used by the probe endpoint to scrape a target.
+// Unset credentials, TLS files and timeout are inherited from the global configuration.
+// Only targets matching the allow-list can be probed so credentials are not sent to any host.
+type Module struct {
+	// Hosts or glob patterns like *.example.com, with an optional port, allowed as target.
+	Targets []string `mapstructure:"targets"`
+	// Whether targets can be requested with http, credentials are then sent in clear.
+	AllowHTTP bool `mapstructure:"allow-http"`
+	// Nil when unset to inherit the global value.
+	SkipVerify         *bool  `mapstructure:"skip-verify"`
+	CAFile             string `mapstructure:"ca-file"`
+	CertFile           string `mapstructure:"cert-file"`
+	KeyFile            string `mapstructure:"key-file"`
+	ServerName         string `mapstructure:"server-name"`
+	TLSMinVersion      string `mapstructure:"tls-min-version"`
+	APIVersion         string `mapstructure:"api-version"`
+	Timeout            int    `mapstructure:"timeout"`
+	WallixUsername     string `mapstructure:"wallix-username"`
+	WallixPassword     string `mapstructure:"wallix-password"`
+	WallixPasswordFile string `mapstructure:"wallix-password-file"`
+	WallixAPIKey       string `mapstructure:"wallix-api-key"`
+	VaultPath          string `mapstructure:"vault-path"`
 }
 
 // Entry point function to load the configuration with the following precedence order:
 // - flag
 // - env var
 // - config file
-// The config file is optional.
-func LoadConfig(path string) (config Config, err error) {
-	if err := SetFlags(); err != nil {
+// The config file is optional unless given explicitly, its format depends on its extension.
+// The collectors are the names of available collectors with their default state.
+// The reserved paths are served by other endpoints so the telemetry path cannot be one of them.
+func LoadConfig(collectors map[string]bool, reservedPaths []string) (config Config, err error) {
+	if err := SetFlags(collectors); err != nil {
 		return config, err
 	}
 
-	// Set variables from config file
-	viper.SetConfigName("config")
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath(path)
+	// Set variables from environment
+	viper.AutomaticEnv()
+
+	// Required to bind flag with env var
+	replacer := strings.NewReplacer("-", "_", ".", "_")
+	viper.SetEnvKeyReplacer(replacer)
+
+	// Set variables from config file, searched in default paths with any supported extension if not given
+	if file := viper.GetString("config.file"); file != "" {
+		viper.SetConfigFile(file)
+	} else {
+		viper.SetConfigName("config")
+		for _, path := range configPaths {
+			viper.AddConfigPath(path)
+		}
+	}
+
+	config, err = ReloadConfig(collectors, reservedPaths)
+
+	// Handle special check flag not binded to viper
+	if checkConfig, _ := pflag.CommandLine.GetBool("check-config"); checkConfig {
+		os.Exit(Check(os.Stdout, config, err))
+	}
 
+	return config, err
+}
+
+// Read again the config file and env vars, flags are only parsed once by LoadConfig.
+// The returned configuration is validated.
+func ReloadConfig(collectors map[string]bool, reservedPaths []string) (config Config, err error) {
 	if err := viper.ReadInConfig(); err != nil {
 		// Config file is optional, so ignore error if it does not exist
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok { //nolint:errorlint
@@ -46,63 +147,322 @@ func LoadConfig(path string) (config Config, err error) {
 		}
 	}
 
-	// Set variables from environment
-	viper.AutomaticEnv()
+	if err := viper.Unmarshal(&config); err != nil {
+		return config, err
+	}
+	// Dotted keys are nested maps for viper so they cannot be unmarshaled directly
+	config.WebConfigFile = viper.GetString("web.config.file")
+	config.LogLevel = viper.GetString("log.level")
+	config.LogFormat = viper.GetString("log.format")
 
-	// Required to bind flag with env var
-	replacer := strings.NewReplacer("-", "_")
-	viper.SetEnvKeyReplacer(replacer)
+	return config, config.Validate(collectors, reservedPaths)
+}
 
-	// Check mandatory parameters
-	if !viper.IsSet("wallix-username") {
-		return config, fmt.Errorf("wallix-username is a mandatory input")
+// Configuration of the logger, the level can be changed on reload but not the format.
+func (c Config) Logging() *promlog.Config {
+	logging := &promlog.Config{Level: &promlog.AllowedLevel{}, Format: &promlog.AllowedFormat{}}
+	// Invalid values are reported by Validate, defaults are used meanwhile
+	if err := logging.Level.Set(c.LogLevel); err != nil {
+		_ = logging.Level.Set("info")
 	}
-	if !viper.IsSet("wallix-password") {
-		return config, fmt.Errorf("wallix-password is a mandatory input")
+	if err := logging.Format.Set(c.LogFormat); err != nil {
+		_ = logging.Format.Set("logfmt")
 	}
 
-	if err := viper.Unmarshal(&config); err != nil {
+	return logging
+}
+
+// Whether a password, from any source, or an API key is defined.
+func (c Config) hasSecret() bool {
+	return c.WallixPassword != "" || c.WallixPasswordFile != "" || c.VaultPath != "" || c.WallixAPIKey != ""
+}
+
+// Whether both a username and a secret are defined to authenticate to the API.
+func (c Config) HasCredentials() bool {
+	return c.WallixUsername != "" && c.hasSecret()
+}
+
+// Build the configuration to scrape the target with the settings of the module.
+// The target can be a full URI to the API or only a host with optional port.
+func (c Config) ForTarget(target string, module string) (config Config, err error) {
+	if module == "" {
+		module = DefaultModule
+	}
+
+	config = c
+	config.Modules = nil
+	// The state file is bound to the global scrape URI
+	config.SessionsStateFile = ""
+
+	// Without module, credentials could be sent to any host requested
+	settings, ok := c.Modules[module]
+	if !ok {
+		return config, fmt.Errorf("unknown module %q", module)
+	}
+	scrapeURI, err := settings.targetURI(target)
+	if err != nil {
 		return config, err
 	}
+	config.ScrapeURI = scrapeURI
+
+	if settings.SkipVerify != nil {
+		config.SkipVerify = *settings.SkipVerify
+	}
+	if settings.CAFile != "" {
+		config.CAFile = settings.CAFile
+	}
+	// The client certificate of the module replaces the global one as a whole
+	if settings.CertFile != "" {
+		config.CertFile = settings.CertFile
+		config.KeyFile = settings.KeyFile
+	}
+	if settings.ServerName != "" {
+		config.ServerName = settings.ServerName
+	}
+	if settings.TLSMinVersion != "" {
+		config.TLSMinVersion = settings.TLSMinVersion
+	}
+	if settings.APIVersion != "" {
+		config.APIVersion = settings.APIVersion
+	}
+	if settings.Timeout != 0 {
+		config.Timeout = settings.Timeout
+	}
+	if settings.WallixUsername != "" {
+		config.WallixUsername = settings.WallixUsername
+	}
+	// Credentials of the module replace the global ones as a whole
+	if settings.WallixPassword != "" || settings.WallixPasswordFile != "" ||
+		settings.VaultPath != "" || settings.WallixAPIKey != "" {
+		config.WallixPassword = settings.WallixPassword
+		config.WallixPasswordFile = settings.WallixPasswordFile
+		config.VaultPath = settings.VaultPath
+		config.WallixAPIKey = settings.WallixAPIKey
+	}
+
+	if !config.HasCredentials() {
+		return config, fmt.Errorf("no credentials available for module %q", module)
+	}
 
 	return config, nil
 }
 
+// Build the API URI of the target, if it is allowed by the module.
+func (m Module) targetURI(target string) (string, error) {
+	if !strings.Contains(target, "://") {
+		target = "https://" + target + "/api"
+	}
+	scrapeURI, err := url.Parse(target)
+	if err != nil {
+		return "", fmt.Errorf("invalid target %q: %w", target, err)
+	}
+	switch {
+	case scrapeURI.Scheme == "https":
+	case scrapeURI.Scheme == "http" && m.AllowHTTP:
+	default:
+		return "", fmt.Errorf("target %q must use https scheme", target)
+	}
+	if scrapeURI.User != nil {
+		return "", fmt.Errorf("target %q cannot contain credentials", target)
+	}
+	if !m.allows(scrapeURI) {
+		return "", fmt.Errorf("target %q is not allowed by the module", target)
+	}
+
+	return strings.TrimSuffix(scrapeURI.String(), "/"), nil
+}
+
+// Whether the host of the URI matches one of the targets, with its port if the pattern has one.
+func (m Module) allows(scrapeURI *url.URL) bool {
+	for _, pattern := range m.Targets {
+		host := scrapeURI.Hostname()
+		if strings.Contains(pattern, ":") {
+			host = scrapeURI.Host
+		}
+		if matched, _ := path.Match(pattern, host); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Set flags and default variables.
-func SetFlags() (err error) {
+func SetFlags(collectors map[string]bool) (err error) {
 	helpFlag := pflag.BoolP("help", "h", false, "help message")
+	versionFlag := pflag.Bool("version", false, "Print version information and exit")
+	pflag.String("config.file", "", "Path to the config file in YAML, JSON or TOML, config.yaml is searched if empty")
+	pflag.Bool("check-config", false, "Validate the configuration, print it with secrets redacted and exit")
 	pflag.String("listen-address", ":9191", "Address to listen on for web interface and telemetry")
+	pflag.String("log.level", "info", "Only log messages with the given severity or above: debug, info, warn or error")
+	pflag.String("log.format", "logfmt", "Output format of log messages: logfmt or json")
+	pflag.String("web.config.file", "", "Path to the web config file to enable TLS or basic authentication")
 	pflag.String("telemetry-path", "/metrics", "Path under which to expose metrics")
 	pflag.StringP("scrape-uri", "w", "https://127.0.0.1/api", "URI on which to scrape Wallix Bastion API")
+	pflag.String(
+		"api-version", "",
+		"Version of Wallix Bastion API like 3.6, auto to detect the highest supported one, default of the bastion if empty",
+	)
 	pflag.StringP("wallix-username", "u", "", "The username used for authentication to request Wallix Bastion API")
 	pflag.StringP("wallix-password", "p", "", "The password used for authentication to request Wallix Bastion API")
+	pflag.String("wallix-password-file", "", "File containing the password, read at each authentication")
+	pflag.String(
+		"wallix-api-key", "",
+		"The API key used with the username for authentication to request Wallix Bastion API instead of password",
+	)
 
 	pflag.BoolP("skip-verify", "s", false, "Flag that disables TLS certificate verification for the scrape URI")
+	pflag.String("vault-addr", "http://127.0.0.1:8200", "Address of HashiCorp Vault to read the password from")
+	pflag.String("vault-token", "", "Token used for authentication to request HashiCorp Vault")
+	pflag.String("vault-path", "", "Path of the Vault KV secret containing the password, like secret/data/wallix")
+	pflag.String("vault-field", "password", "Key of the password in the Vault KV secret")
+	pflag.String("ca-file", "", "PEM file of certificate authorities to verify Wallix Bastion API certificate")
+	pflag.String("cert-file", "", "PEM file of the client certificate to authenticate to Wallix Bastion API")
+	pflag.String("key-file", "", "PEM file of the client certificate private key")
+	pflag.String("server-name", "", "Server name to verify Wallix Bastion API certificate, host of scrape URI if empty")
+	pflag.String("tls-min-version", "", "Minimum TLS version accepted: 1.0, 1.1, 1.2 or 1.3")
 	pflag.IntP("timeout", "t", defaultTimeout, "Timeout in seconds for requests to Wallix Bastion API")
+	pflag.Int("refresh-interval", 0, "Interval in seconds to refresh metrics in background, disabled if 0")
+	pflag.Int(
+		"sessions-closed-window", defaultSessionsClosedWindow,
+		"Timeframe in seconds over which closed sessions are counted",
+	)
+	pflag.String(
+		"sessions-closed-window-mode", SessionsClosedWindowFixed,
+		"How to determine the closed sessions timeframe: fixed, scrape-timeout or last-scrape",
+	)
+	pflag.String("sessions-state-file", "", "File to persist sessions counters across restarts")
+	pflag.Bool("sessions-by-device", false, "Flag that enables the breakdown of current sessions per target device")
+	pflag.Bool("sessions-by-user-group", false, "Flag that enables the breakdown of current sessions per user group")
+	pflag.Int(
+		"sessions-breakdown-limit", defaultSessionsBreakdownLimit,
+		"Maximum number of devices or user groups in breakdowns, others are aggregated, unlimited if 0",
+	)
+	pflag.IntSlice(
+		"sessions-duration-buckets", defaultSessionsDurationBuckets,
+		"Upper bounds in seconds of the closed sessions duration histogram buckets",
+	)
+	pflag.IntSlice(
+		"sessions-age-thresholds", defaultSessionsAgeThresholds,
+		"Thresholds in seconds to count current sessions open for too long",
+	)
+	pflag.Bool("sessions-age-by-target", false, "Flag that labels sessions age metrics by protocol and target device")
+	for name, isDefaultEnabled := range collectors {
+		pflag.Bool("collector."+name, isDefaultEnabled, fmt.Sprintf("Enable the %s collector", name))
+		pflag.Bool("no-collector."+name, false, fmt.Sprintf("Disable the %s collector", name))
+	}
 	pflag.Parse()
 
 	// Bind to viper all other flags
+	if err := viper.BindPFlag("config.file", pflag.Lookup("config.file")); err != nil {
+		return err
+	}
 	if err := viper.BindPFlag("listen-address", pflag.Lookup("listen-address")); err != nil {
 		return err
 	}
+	if err := viper.BindPFlag("log.level", pflag.Lookup("log.level")); err != nil {
+		return err
+	}
+	if err := viper.BindPFlag("log.format", pflag.Lookup("log.format")); err != nil {
+		return err
+	}
+	if err := viper.BindPFlag("web.config.file", pflag.Lookup("web.config.file")); err != nil {
+		return err
+	}
 	if err := viper.BindPFlag("telemetry-path", pflag.Lookup("telemetry-path")); err != nil {
 		return err
 	}
 	if err := viper.BindPFlag("scrape-uri", pflag.Lookup("scrape-uri")); err != nil {
 		return err
 	}
+	if err := viper.BindPFlag("api-version", pflag.Lookup("api-version")); err != nil {
+		return err
+	}
 	if err := viper.BindPFlag("wallix-username", pflag.Lookup("wallix-username")); err != nil {
 		return err
 	}
 	if err := viper.BindPFlag("wallix-password", pflag.Lookup("wallix-password")); err != nil {
 		return err
 	}
+	if err := viper.BindPFlag("wallix-password-file", pflag.Lookup("wallix-password-file")); err != nil {
+		return err
+	}
+	if err := viper.BindPFlag("wallix-api-key", pflag.Lookup("wallix-api-key")); err != nil {
+		return err
+	}
+	if err := viper.BindPFlag("vault-addr", pflag.Lookup("vault-addr")); err != nil {
+		return err
+	}
+	if err := viper.BindPFlag("vault-token", pflag.Lookup("vault-token")); err != nil {
+		return err
+	}
+	if err := viper.BindPFlag("vault-path", pflag.Lookup("vault-path")); err != nil {
+		return err
+	}
+	if err := viper.BindPFlag("vault-field", pflag.Lookup("vault-field")); err != nil {
+		return err
+	}
 	if err := viper.BindPFlag("skip-verify", pflag.Lookup("skip-verify")); err != nil {
 		return err
 	}
+	if err := viper.BindPFlag("ca-file", pflag.Lookup("ca-file")); err != nil {
+		return err
+	}
+	if err := viper.BindPFlag("cert-file", pflag.Lookup("cert-file")); err != nil {
+		return err
+	}
+	if err := viper.BindPFlag("key-file", pflag.Lookup("key-file")); err != nil {
+		return err
+	}
+	if err := viper.BindPFlag("server-name", pflag.Lookup("server-name")); err != nil {
+		return err
+	}
+	if err := viper.BindPFlag("tls-min-version", pflag.Lookup("tls-min-version")); err != nil {
+		return err
+	}
 	if err := viper.BindPFlag("timeout", pflag.Lookup("timeout")); err != nil {
 		return err
 	}
+	if err := viper.BindPFlag("refresh-interval", pflag.Lookup("refresh-interval")); err != nil {
+		return err
+	}
+	if err := viper.BindPFlag("sessions-closed-window", pflag.Lookup("sessions-closed-window")); err != nil {
+		return err
+	}
+	if err := viper.BindPFlag("sessions-closed-window-mode", pflag.Lookup("sessions-closed-window-mode")); err != nil {
+		return err
+	}
+	if err := viper.BindPFlag("sessions-state-file", pflag.Lookup("sessions-state-file")); err != nil {
+		return err
+	}
+	if err := viper.BindPFlag("sessions-by-device", pflag.Lookup("sessions-by-device")); err != nil {
+		return err
+	}
+	if err := viper.BindPFlag("sessions-by-user-group", pflag.Lookup("sessions-by-user-group")); err != nil {
+		return err
+	}
+	if err := viper.BindPFlag("sessions-breakdown-limit", pflag.Lookup("sessions-breakdown-limit")); err != nil {
+		return err
+	}
+	if err := viper.BindPFlag("sessions-duration-buckets", pflag.Lookup("sessions-duration-buckets")); err != nil {
+		return err
+	}
+	if err := viper.BindPFlag("sessions-age-thresholds", pflag.Lookup("sessions-age-thresholds")); err != nil {
+		return err
+	}
+	if err := viper.BindPFlag("sessions-age-by-target", pflag.Lookup("sessions-age-by-target")); err != nil {
+		return err
+	}
+
+	for name := range collectors {
+		if err := viper.BindPFlag("collector."+name, pflag.Lookup("collector."+name)); err != nil {
+			return err
+		}
+		// The negative flag takes precedence over any other source
+		if disabled, _ := pflag.CommandLine.GetBool("no-collector." + name); disabled {
+			viper.Set("collector."+name, false)
+		}
+	}
 
 	// Handle special help flag not binded to viper
 	if *helpFlag {
@@ -110,6 +470,10 @@ func SetFlags() (err error) {
 		pflag.PrintDefaults()
 		os.Exit(0)
 	}
+	if *versionFlag {
+		fmt.Println(version.Print(ProgramName))
+		os.Exit(0)
+	}
 
 	return nil
 }
@@ -0,0 +1,225 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/claranet/wallix_bastion_exporter/httpclient"
+	"github.com/claranet/wallix_bastion_exporter/wallix"
+	"github.com/prometheus/common/promlog"
+	"github.com/prometheus/exporter-toolkit/web"
+)
+
+var apiVersionPattern = regexp.MustCompile(`^[0-9]+\.[0-9]+$`)
+
+// Returned when the configuration has one or more problems.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n- " + strings.Join(e.Problems, "\n- ")
+}
+
+// Check the whole configuration and report all problems at once.
+// The collectors are the names of available collectors,
+// the reserved paths are the ones of other endpoints which cannot be used as telemetry path.
+func (c Config) Validate(collectors map[string]bool, reservedPaths []string) error {
+	validation := &ValidationError{}
+	addf := func(format string, a ...interface{}) {
+		validation.Problems = append(validation.Problems, fmt.Sprintf(format, a...))
+	}
+
+	if _, _, err := net.SplitHostPort(c.ListenAddress); err != nil {
+		addf("listen-address %q must be like host:port or :port: %v", c.ListenAddress, err)
+	}
+	if err := (&promlog.AllowedLevel{}).Set(c.LogLevel); err != nil {
+		addf("log.level %v", err)
+	}
+	if err := (&promlog.AllowedFormat{}).Set(c.LogFormat); err != nil {
+		addf("log.format %v", err)
+	}
+	if err := web.Validate(c.WebConfigFile); err != nil {
+		addf("web.config.file %q is invalid: %v", c.WebConfigFile, err)
+	}
+	if !strings.HasPrefix(c.TelemetryPath, "/") {
+		addf("telemetry-path %q must start with /", c.TelemetryPath)
+	}
+	for _, path := range reservedPaths {
+		if c.TelemetryPath == path {
+			addf("telemetry-path cannot be %s which is reserved to another endpoint", path)
+		}
+	}
+	if err := checkURL(c.ScrapeURI); err != nil {
+		addf("scrape-uri %v", err)
+	}
+	if err := checkAPIVersion(c.APIVersion); err != nil {
+		addf("api-version %v", err)
+	}
+	if c.Timeout <= 0 {
+		addf("timeout must be positive, got %d", c.Timeout)
+	}
+	if c.RefreshInterval < 0 {
+		addf("refresh-interval cannot be negative, got %d", c.RefreshInterval)
+	}
+
+	switch c.SessionsClosedWindowMode {
+	case SessionsClosedWindowFixed, SessionsClosedWindowScrapeTimeout, SessionsClosedWindowLastScrape:
+	default:
+		addf("unknown sessions-closed-window-mode %q, expected one of %s, %s or %s", c.SessionsClosedWindowMode,
+			SessionsClosedWindowFixed, SessionsClosedWindowScrapeTimeout, SessionsClosedWindowLastScrape)
+	}
+	if c.SessionsClosedWindow <= 0 {
+		addf("sessions-closed-window must be positive, got %d", c.SessionsClosedWindow)
+	}
+	if c.SessionsBreakdownLimit < 0 {
+		addf("sessions-breakdown-limit cannot be negative, got %d", c.SessionsBreakdownLimit)
+	}
+	for _, bucket := range c.SessionsDurationBuckets {
+		if bucket <= 0 {
+			addf("sessions-duration-buckets must be positive, got %d", bucket)
+		}
+	}
+	for _, threshold := range c.SessionsAgeThresholds {
+		if threshold <= 0 {
+			addf("sessions-age-thresholds must be positive, got %d", threshold)
+		}
+	}
+
+	for _, problem := range checkTLS(c.CAFile, c.CertFile, c.KeyFile, c.TLSMinVersion) {
+		addf("%s", problem)
+	}
+	for _, problem := range checkSecrets(c.WallixPasswordFile, c.VaultPath, c.VaultAddr, c.VaultToken) {
+		addf("%s", problem)
+	}
+
+	// Credentials can be defined per module only when the exporter is used exclusively through the probe endpoint
+	if len(c.Modules) == 0 {
+		if c.WallixUsername == "" {
+			addf("wallix-username is a mandatory input")
+		}
+		if !c.hasSecret() {
+			addf("one of wallix-password, wallix-password-file, vault-path or wallix-api-key is a mandatory input")
+		}
+	}
+
+	names := make([]string, 0, len(c.Modules))
+	for name := range c.Modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		module := c.Modules[name]
+		if len(module.Targets) == 0 {
+			addf("module %q: targets must list the hosts allowed to be probed", name)
+		}
+		for _, pattern := range module.Targets {
+			if _, err := path.Match(pattern, ""); err != nil {
+				addf("module %q: invalid target pattern %q: %v", name, pattern, err)
+			}
+		}
+		if module.Timeout < 0 {
+			addf("module %q: timeout cannot be negative, got %d", name, module.Timeout)
+		}
+		if err := checkAPIVersion(module.APIVersion); err != nil {
+			addf("module %q: api-version %v", name, err)
+		}
+		for _, problem := range checkTLS(module.CAFile, module.CertFile, module.KeyFile, module.TLSMinVersion) {
+			addf("module %q: %s", name, problem)
+		}
+		for _, problem := range checkSecrets(module.WallixPasswordFile, module.VaultPath, c.VaultAddr, c.VaultToken) {
+			addf("module %q: %s", name, problem)
+		}
+	}
+
+	for name := range c.Collectors {
+		if _, ok := collectors[name]; !ok {
+			addf("unknown collector %q", name)
+		}
+	}
+
+	if len(validation.Problems) > 0 {
+		sort.Strings(validation.Problems)
+
+		return validation
+	}
+
+	return nil
+}
+
+// Check the URL is absolute with an http or https scheme.
+func checkURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%q is not a valid URL: %w", rawURL, err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("%q must use http or https scheme", rawURL)
+	}
+	if parsed.Host == "" {
+		return fmt.Errorf("%q must have a host", rawURL)
+	}
+
+	return nil
+}
+
+// Check the API version is empty, auto or like 3.6.
+func checkAPIVersion(version string) error {
+	if version == "" || version == wallix.APIVersionAuto || apiVersionPattern.MatchString(version) {
+		return nil
+	}
+
+	return fmt.Errorf("%q must be like 3.6 or %s", version, wallix.APIVersionAuto)
+}
+
+func checkTLS(caFile string, certFile string, keyFile string, minVersion string) (problems []string) {
+	if (certFile == "") != (keyFile == "") {
+		problems = append(problems, "cert-file and key-file must be set together")
+	}
+	if _, err := httpclient.ParseTLSVersion(minVersion); err != nil {
+		problems = append(problems, fmt.Sprintf("invalid tls-min-version: %v", err))
+	}
+	for option, file := range map[string]string{"ca-file": caFile, "cert-file": certFile, "key-file": keyFile} {
+		if problem := checkFile(option, file); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+
+	return problems
+}
+
+func checkSecrets(passwordFile string, vaultPath string, vaultAddr string, vaultToken string) (problems []string) {
+	if problem := checkFile("wallix-password-file", passwordFile); problem != "" {
+		problems = append(problems, problem)
+	}
+	if vaultPath != "" {
+		if err := checkURL(vaultAddr); err != nil {
+			problems = append(problems, fmt.Sprintf("vault-addr %v", err))
+		}
+		if vaultToken == "" {
+			problems = append(problems, "vault-token is required with vault-path")
+		}
+	}
+
+	return problems
+}
+
+// Check an optional file is readable, the problem is empty if it is.
+func checkFile(option string, file string) string {
+	if file == "" {
+		return ""
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Sprintf("%s cannot be read: %v", option, err)
+	}
+	f.Close()
+
+	return ""
+}
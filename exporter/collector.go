@@ -0,0 +1,106 @@
+package exporter
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/claranet/wallix_bastion_exporter/config"
+	"github.com/claranet/wallix_bastion_exporter/wallix"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// A collector gathers a group of metrics from Wallix Bastion API.
+type Collector interface {
+	// Request the API and send the resulting metrics to the channel.
+	// The context is canceled when the scrape is abandoned or times out.
+	Update(ctx context.Context, scrape Scrape, metricsChannel chan<- prometheus.Metric, client *wallix.Client) error
+}
+
+// Information about the scrape request which triggered the collect.
+// It is empty when the collect is not bound to a scrape like the background refresh.
+type Scrape struct {
+	// Timeout announced by Prometheus, zero if unknown.
+	Timeout time.Duration
+}
+
+// Errors of independent requests done by a collector, each one is logged with its own details.
+type collectorErrors []error
+
+func (e collectorErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+
+	return strings.Join(messages, ", ")
+}
+
+// Part of the scrape timeout kept to send the response to Prometheus.
+const scrapeTimeoutOffset = 500 * time.Millisecond
+
+// Extract scrape information from the headers sent by Prometheus.
+func NewScrape(req *http.Request) (scrape Scrape) {
+	timeoutSeconds, err := strconv.ParseFloat(req.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"), 64)
+	if err == nil && timeoutSeconds > 0 {
+		scrape.Timeout = time.Duration(timeoutSeconds * float64(time.Second))
+	}
+
+	return scrape
+}
+
+type collectorFactory func(cfg config.Config, logger log.Logger) Collector
+
+var (
+	factories              = map[string]collectorFactory{}
+	collectorsDefaultState = map[string]bool{}
+)
+
+// Make a collector available under its name, called from init of each collector.
+func registerCollector(name string, isDefaultEnabled bool, factory collectorFactory) {
+	factories[name] = factory
+	collectorsDefaultState[name] = isDefaultEnabled
+}
+
+// Names of all available collectors with their default state.
+func Collectors() map[string]bool {
+	collectors := make(map[string]bool, len(collectorsDefaultState))
+	for name, isDefaultEnabled := range collectorsDefaultState {
+		collectors[name] = isDefaultEnabled
+	}
+
+	return collectors
+}
+
+// Build collectors enabled by the configuration, falling back to their default state.
+func newCollectors(cfg config.Config, logger log.Logger) map[string]Collector {
+	collectors := map[string]Collector{}
+	for name, factory := range factories {
+		isEnabled, ok := cfg.Collectors[name]
+		if !ok {
+			isEnabled = collectorsDefaultState[name]
+		}
+		if isEnabled {
+			collectors[name] = factory(cfg, log.With(logger, "collector", name))
+		}
+	}
+
+	return collectors
+}
+
+// Derive a context canceled before the scrape times out, unchanged if the timeout is unknown.
+func (s Scrape) withDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	timeout := s.Timeout - scrapeTimeoutOffset
+	if timeout <= 0 {
+		timeout = s.Timeout
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,41 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/claranet/wallix_bastion_exporter/config"
+	"github.com/claranet/wallix_bastion_exporter/wallix"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var metricDevices = prometheus.NewDesc(
+	prometheus.BuildFQName(Namespace, "", "devices"),
+	"Current number of devices.",
+	nil, nil,
+)
+
+type devicesCollector struct{}
+
+func init() {
+	registerCollector("devices", true, newDevicesCollector)
+}
+
+func newDevicesCollector(_ config.Config, _ log.Logger) Collector {
+	return &devicesCollector{}
+}
+
+func (c *devicesCollector) Update(
+	ctx context.Context, _ Scrape, metricsChannel chan<- prometheus.Metric, client *wallix.Client,
+) error {
+	devices, err := client.GetDevices(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot get devices: %w", err)
+	}
+	metricsChannel <- prometheus.MustNewConstMetric(
+		metricDevices, prometheus.GaugeValue, float64(len(devices)),
+	)
+
+	return nil
+}
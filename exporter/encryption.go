@@ -0,0 +1,65 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/claranet/wallix_bastion_exporter/config"
+	"github.com/claranet/wallix_bastion_exporter/wallix"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	metricEncryptionStatus = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "", "encryption_status"),
+		"Encryption status (need_setup=0, ready=1, need_passphrase=2).",
+		[]string{"status", "security_level"}, nil,
+	)
+	metricEncryptionSecurityLevel = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "", "encryption_security_level"),
+		"Encryption security level (need_setup=0, passphrase_defined=1, passphrase_not_used=2, [hidden]=-1).",
+		[]string{"security_level", "status"}, nil,
+	)
+)
+
+type encryptionCollector struct{}
+
+func init() {
+	registerCollector("encryption", true, newEncryptionCollector)
+}
+
+func newEncryptionCollector(_ config.Config, _ log.Logger) Collector {
+	return &encryptionCollector{}
+}
+
+func (c *encryptionCollector) Update(
+	ctx context.Context, _ Scrape, metricsChannel chan<- prometheus.Metric, client *wallix.Client,
+) error {
+	encryptionMap := map[string]int{
+		"ready":               1,
+		"need_setup":          0,
+		"need_passphrase":     2, // nolint:gomnd
+		"passphrase_not_used": 2, // nolint:gomnd
+		"passphrase_defined":  1,
+		"[hidden]":            -1,
+	}
+	encryptionInfo, err := client.GetEncryption(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot get encryption information: %w", err)
+	}
+	metricsChannel <- prometheus.MustNewConstMetric(
+		metricEncryptionStatus,
+		prometheus.GaugeValue,
+		float64(encryptionMap[encryptionInfo.Encryption]),
+		encryptionInfo.Encryption, encryptionInfo.SecurityLevel,
+	)
+	metricsChannel <- prometheus.MustNewConstMetric(
+		metricEncryptionSecurityLevel,
+		prometheus.GaugeValue,
+		float64(encryptionMap[encryptionInfo.SecurityLevel]),
+		encryptionInfo.SecurityLevel, encryptionInfo.Encryption,
+	)
+
+	return nil
+}
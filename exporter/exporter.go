@@ -1,20 +1,23 @@
 package exporter
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/claranet/wallix_bastion_exporter/config"
 	"github.com/claranet/wallix_bastion_exporter/httpclient"
+	"github.com/claranet/wallix_bastion_exporter/secrets"
 	"github.com/claranet/wallix_bastion_exporter/wallix"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 const (
-	// ony used for metrics based on past timeframe like the closed sessions.
-	sessionsClosedMinutes = 5 // TODO expose as config parameter?
 	// prometheus exporter Namespace.
 	Namespace = "wallix_bastion"
 )
@@ -25,143 +28,170 @@ var (
 		"Was able to request and authenticate to Wallix Bastion API successfully.",
 		nil, nil,
 	)
-	metricUsers = prometheus.NewDesc(
-		prometheus.BuildFQName(Namespace, "", "users"),
-		"Current number of users.",
+	metricLastRefresh = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "", "last_refresh_timestamp_seconds"),
+		"Timestamp of the last background refresh of metrics.",
 		nil, nil,
 	)
-	metricGroups = prometheus.NewDesc(
-		prometheus.BuildFQName(Namespace, "", "groups"),
-		"Current number of groups.",
-		nil, nil,
-	)
-	metricDevices = prometheus.NewDesc(
-		prometheus.BuildFQName(Namespace, "", "devices"),
-		"Current number of devices.",
-		nil, nil,
-	)
-	metricSessions = prometheus.NewDesc(
-		prometheus.BuildFQName(Namespace, "", "sessions"),
-		fmt.Sprintf("Number of sessions for the last %dm.", sessionsClosedMinutes),
-		[]string{"status"}, nil,
-	)
-	metricTargets = prometheus.NewDesc(
-		prometheus.BuildFQName(Namespace, "", "targets"),
-		"Current number of targets.",
-		[]string{"type"}, nil,
-	)
-	metricEncryptionStatus = prometheus.NewDesc(
-		prometheus.BuildFQName(Namespace, "", "encryption_status"),
-		"Encryption status (need_setup=0, ready=1, need_passphrase=2).",
-		[]string{"status", "security_level"}, nil,
-	)
-	metricEncryptionSecurityLevel = prometheus.NewDesc(
-		prometheus.BuildFQName(Namespace, "", "encryption_security_level"),
-		"Encryption security level (need_setup=0, passphrase_defined=1, passphrase_not_used=2, [hidden]=-1).",
-		[]string{"security_level", "status"}, nil,
-	)
-	metricLicenseIsExpired = prometheus.NewDesc(
-		prometheus.BuildFQName(Namespace, "", "license_is_expired"),
-		"Is the Wallix is expired (0=false, 1=true).",
-		nil, nil,
-	)
-	metricLicensePrimaryPct = prometheus.NewDesc(
-		prometheus.BuildFQName(Namespace, "", "license_primary_ratio"),
-		"License usage percentage of primary.",
-		nil, nil,
+	metricScrapeCollectorSuccess = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "scrape", "collector_success"),
+		"Whether a collector succeeded to gather its metrics.",
+		[]string{"collector"}, nil,
 	)
-	metricLicenseSecondaryPct = prometheus.NewDesc(
-		prometheus.BuildFQName(Namespace, "", "license_secondary_ratio"),
-		"License usage percentage of secondary.",
-		nil, nil,
-	)
-	metricLicenseNameUserPct = prometheus.NewDesc(
-		prometheus.BuildFQName(Namespace, "", "license_named_user_ratio"),
-		"License usage percentage of named user.",
-		nil, nil,
-	)
-	metricLicenseResourcePct = prometheus.NewDesc(
-		prometheus.BuildFQName(Namespace, "", "license_resource_ratio"),
-		"License usage percentage of resource.",
-		nil, nil,
-	)
-	metricLicenseWaapmPct = prometheus.NewDesc(
-		prometheus.BuildFQName(Namespace, "", "license_waapm_ratio"),
-		"License usage percentage of waapm.",
-		nil, nil,
-	)
-	metricLicensePmTargetPct = prometheus.NewDesc(
-		prometheus.BuildFQName(Namespace, "", "license_pm_target_ratio"),
-		"License usage percentage of pm target.",
-		nil, nil,
-	)
-	metricLicenseSmTargetPct = prometheus.NewDesc(
-		prometheus.BuildFQName(Namespace, "", "license_sm_target_ratio"),
-		"License usage percentage of sm target.",
-		nil, nil,
+	metricScrapeCollectorDuration = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "scrape", "collector_duration_seconds"),
+		"Duration of a collector to gather its metrics.",
+		[]string{"collector"}, nil,
 	)
 )
 
 type Exporter struct {
 	Config config.Config
+	logger log.Logger
+	// Long-lived client keeping the session to the API across scrapes.
+	client     *wallix.Client
+	collectors map[string]Collector
+	snapshot   *snapshot
 }
 
-func NewExporter(config config.Config) *Exporter {
+func NewExporter(config config.Config, logger log.Logger) (*Exporter, error) {
+	httpConfig := httpclient.HTTPConfig{
+		SkipVerify:    config.SkipVerify,
+		CAFile:        config.CAFile,
+		CertFile:      config.CertFile,
+		KeyFile:       config.KeyFile,
+		ServerName:    config.ServerName,
+		TLSMinVersion: config.TLSMinVersion,
+		Timeout:       config.Timeout,
+		Headers: map[string]string{
+			"User-Agent": "prometheus_exporter_" + Namespace,
+		},
+		// Using a cookie speed up metrics fetch by avoiding basic auth on every requests
+		CookieManager: true,
+		Logger:        logger,
+	}
+	if config.WallixAPIKey != "" {
+		httpConfig.Username = config.WallixUsername
+		httpConfig.APIKey = config.WallixAPIKey
+	}
+	httpClient, err := httpConfig.Build()
+	if err != nil {
+		return nil, fmt.Errorf("init exporter failed: %w", err)
+	}
+	client := wallix.NewClient(httpClient, config.ScrapeURI)
+	client.APIVersion = config.APIVersion
+	client.Username = config.WallixUsername
+	client.Password = passwordProvider(config, httpClient.Timeout)
+	client.UseAPIKey = config.WallixAPIKey != ""
+	client.Observer = apiObserver{}
+
 	return &Exporter{
-		Config: config,
+		Config:     config,
+		logger:     logger,
+		client:     client,
+		collectors: newCollectors(config, logger),
+	}, nil
+}
+
+// The source of the password depending on the configuration, read at each authentication.
+func passwordProvider(config config.Config, timeout time.Duration) secrets.Provider {
+	switch {
+	case config.WallixPasswordFile != "":
+		return secrets.File(config.WallixPasswordFile)
+	case config.VaultPath != "":
+		return &secrets.Vault{
+			HTTPClient: &http.Client{Timeout: timeout},
+			Address:    config.VaultAddr,
+			Token:      config.VaultToken,
+			Path:       config.VaultPath,
+			Field:      config.VaultField,
+		}
+	default:
+		return secrets.Static(config.WallixPassword)
 	}
 }
 
+// Authenticate to the API if there is no session yet.
+func (e *Exporter) Login(ctx context.Context) error {
+	return e.client.Login(ctx)
+}
+
+// Version of the API requested, empty for the default one or if not detected yet.
+func (e *Exporter) APIVersion() string {
+	return e.client.CurrentAPIVersion()
+}
+
+// Whether the last authentication to the API succeeded and no request failed since, from a cached result.
+func (e *Exporter) Ready() error {
+	at, err := e.client.LastAuthentication()
+	if at.IsZero() {
+		return fmt.Errorf("not authenticated yet")
+	}
+	if err != nil {
+		return fmt.Errorf("API unavailable since %s: %w", at.Format(time.RFC3339), err)
+	}
+
+	return nil
+}
+
+// Close the session to the API and release the connections of the exporter's own transport.
+func (e *Exporter) Close(ctx context.Context) error {
+	defer e.client.HTTPClient.CloseIdleConnections()
+
+	return e.client.Logout(ctx)
+}
+
 func (e *Exporter) Describe(metricsChannel chan<- *prometheus.Desc) {
 	metricsChannel <- metricUp
-	metricsChannel <- metricUsers
-	metricsChannel <- metricGroups
-	metricsChannel <- metricDevices
-	metricsChannel <- metricSessions
-	metricsChannel <- metricTargets
-	metricsChannel <- metricEncryptionStatus
-	metricsChannel <- metricEncryptionSecurityLevel
+	metricsChannel <- metricScrapeCollectorSuccess
+	metricsChannel <- metricScrapeCollectorDuration
+	if e.snapshot != nil {
+		metricsChannel <- metricLastRefresh
+	}
 }
 
 func (e *Exporter) Collect(metricsChannel chan<- prometheus.Metric) {
-	httpConfig := httpclient.HTTPConfig{
-		SkipVerify: e.Config.SkipVerify,
-		Timeout:    e.Config.Timeout,
-		Headers: map[string]string{
-			"User-Agent": "prometheus_exporter_" + Namespace,
-		},
-		// Using a cookie speed up metrics fetch by avoiding basic auth on every requests
-		CookieManager: true,
-	}
-	client, err := httpConfig.Build()
-	if err != nil {
-		log.Println(fmt.Errorf("init exporter failed: %w", err))
+	e.CollectScrape(context.Background(), Scrape{}, metricsChannel)
+}
+
+// Same as Collect but forwarding information of the scrape request to collectors.
+// All requests to the API are canceled with the context or when the scrape times out.
+func (e *Exporter) CollectScrape(ctx context.Context, scrape Scrape, metricsChannel chan<- prometheus.Metric) {
+	if e.snapshot != nil {
+		e.serveSnapshot(metricsChannel)
 
 		return
 	}
 
-	err = e.AuthenticateWallixAPI(metricsChannel, client)
+	e.collect(ctx, scrape, metricsChannel)
+}
+
+// Request the API to gather all metrics.
+func (e *Exporter) collect(ctx context.Context, scrape Scrape, metricsChannel chan<- prometheus.Metric) {
+	ctx, cancel := scrape.withDeadline(ctx)
+	defer cancel()
+
+	err := e.AuthenticateWallixAPI(ctx, metricsChannel, e.client)
 	if err != nil {
-		log.Println(fmt.Errorf("determine up metric failed: %w", err))
+		level.Error(e.logger).Log(append([]interface{}{"msg", "determine up metric failed"}, errorFields(err)...)...)
 
 		return
 	}
 
-	e.FetchWallixMetrics(metricsChannel, client)
+	e.FetchWallixMetrics(ctx, scrape, metricsChannel, e.client)
 }
 
-// The first request done to wallix API. It allows to:
-// - determine "up" metric for the exporter
+// The first request done to wallix API at each scrape. It allows to:
+// - determine "up" metric for the exporter, even with a cached session
 // - prevent trying to fetch other metrics if down
 // - retrieve the cookie to not have to authenticate subsequent requests
-// Notice it uses "POST" methode in contrast to all other requests.
-func (e *Exporter) AuthenticateWallixAPI(metricsChannel chan<- prometheus.Metric, client *http.Client) (err error) {
-	err = wallix.Authenticate(
-		client,
-		e.Config.ScrapeURI,
-		e.Config.WallixUsername,
-		e.Config.WallixPassword,
-	)
+// Notice the login uses "POST" methode in contrast to all other requests.
+// With an API key, there is no login so it only checks the key is accepted.
+// An expired session is renewed by the client on the first rejected request.
+func (e *Exporter) AuthenticateWallixAPI(
+	ctx context.Context, metricsChannel chan<- prometheus.Metric, client *wallix.Client,
+) (err error) {
+	err = client.Ping(ctx)
 	if err != nil {
 		metricsChannel <- prometheus.MustNewConstMetric(
 			metricUp, prometheus.GaugeValue, 0,
@@ -177,36 +207,76 @@ func (e *Exporter) AuthenticateWallixAPI(metricsChannel chan<- prometheus.Metric
 	return nil
 }
 
-// All other metrics fetched from the API essentially
-// by counting the number of elements of list returned
+// All other metrics fetched from the API by the enabled collectors,
+// essentially by counting the number of elements of list returned
 // by different routes.
 func (e *Exporter) FetchWallixMetrics(
-	metricsChannel chan<- prometheus.Metric, client *http.Client,
+	ctx context.Context, scrape Scrape, metricsChannel chan<- prometheus.Metric, client *wallix.Client,
 ) {
 	var wg sync.WaitGroup
 
-	wg.Add(1)
-	go e.gatherMetricsUsers(&wg, metricsChannel, client)
-	wg.Add(1)
-	go e.gatherMetricsGroups(&wg, metricsChannel, client)
-	wg.Add(1)
-	go e.gatherMetricsDevices(&wg, metricsChannel, client)
-	wg.Add(1)
-	go e.gatherMetricsTargetsSessionAccounts(&wg, metricsChannel, client)
-	wg.Add(1)
-	go e.gatherMetricsTargetsSessionAccountMappings(&wg, metricsChannel, client)
-	wg.Add(1)
-	go e.gatherMetricsTargetsSessionInteractiveLogins(&wg, metricsChannel, client)
-	wg.Add(1)
-	go e.gatherMetricsTargetsSessionScenarioAccounts(&wg, metricsChannel, client)
-	wg.Add(1)
-	go e.gatherMetricsTargetsPasswordRetrievalAccounts(&wg, metricsChannel, client)
-	wg.Add(1)
-	go e.gatherMetricsEncryption(&wg, metricsChannel, client)
-	wg.Add(1)
-	go e.gatherMetricsLicense(&wg, metricsChannel, client)
-	wg.Add(1)
-	go e.gatherMetricsSessions(&wg, metricsChannel, client)
+	for name, collector := range e.collectors {
+		wg.Add(1)
+		go e.runCollector(ctx, &wg, name, collector, scrape, metricsChannel, client)
+	}
 
 	wg.Wait()
 }
+
+// Run a collector and send its duration and success metrics.
+func (e *Exporter) runCollector(
+	ctx context.Context,
+	gatherGroup *sync.WaitGroup,
+	name string,
+	collector Collector,
+	scrape Scrape,
+	metricsChannel chan<- prometheus.Metric,
+	client *wallix.Client,
+) {
+	defer gatherGroup.Done()
+
+	begin := time.Now()
+	err := collector.Update(ctx, scrape, metricsChannel, client)
+	duration := time.Since(begin)
+
+	var success float64
+	if err != nil {
+		e.logCollectorError(name, err)
+	} else {
+		success = 1
+		level.Debug(e.logger).Log("msg", "collector succeeded", "collector", name, "duration", duration)
+	}
+
+	metricsChannel <- prometheus.MustNewConstMetric(
+		metricScrapeCollectorDuration, prometheus.GaugeValue, duration.Seconds(), name,
+	)
+	metricsChannel <- prometheus.MustNewConstMetric(
+		metricScrapeCollectorSuccess, prometheus.GaugeValue, success, name,
+	)
+}
+
+// Log each error of a failed collector with the details of the API request, if any.
+func (e *Exporter) logCollectorError(name string, err error) {
+	var errs collectorErrors
+	if !errors.As(err, &errs) {
+		errs = collectorErrors{err}
+	}
+	for _, err := range errs {
+		level.Error(e.logger).Log(append([]interface{}{"msg", "collector failed", "collector", name}, errorFields(err)...)...)
+	}
+}
+
+// Fields to log an error, with the endpoint, status code and duration if the API request failed.
+func errorFields(err error) []interface{} {
+	var requestError *wallix.RequestError
+	if errors.As(err, &requestError) {
+		return []interface{}{
+			"endpoint", requestError.Endpoint,
+			"status_code", requestError.StatusCode,
+			"duration", requestError.Duration,
+			"err", err,
+		}
+	}
+
+	return []interface{}{"err", err}
+}
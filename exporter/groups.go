@@ -0,0 +1,41 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/claranet/wallix_bastion_exporter/config"
+	"github.com/claranet/wallix_bastion_exporter/wallix"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var metricGroups = prometheus.NewDesc(
+	prometheus.BuildFQName(Namespace, "", "groups"),
+	"Current number of groups.",
+	nil, nil,
+)
+
+type groupsCollector struct{}
+
+func init() {
+	registerCollector("groups", true, newGroupsCollector)
+}
+
+func newGroupsCollector(_ config.Config, _ log.Logger) Collector {
+	return &groupsCollector{}
+}
+
+func (c *groupsCollector) Update(
+	ctx context.Context, _ Scrape, metricsChannel chan<- prometheus.Metric, client *wallix.Client,
+) error {
+	groups, err := client.GetGroups(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot get groups: %w", err)
+	}
+	metricsChannel <- prometheus.MustNewConstMetric(
+		metricGroups, prometheus.GaugeValue, float64(len(groups)),
+	)
+
+	return nil
+}
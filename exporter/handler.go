@@ -0,0 +1,44 @@
+package exporter
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Exporter bound to a scrape request.
+type scrapeExporter struct {
+	*Exporter
+	// Context of the scrape request, canceled if Prometheus gives up.
+	ctx    context.Context //nolint:containedctx
+	scrape Scrape
+}
+
+func newScrapeExporter(e *Exporter, req *http.Request) scrapeExporter {
+	return scrapeExporter{
+		Exporter: e,
+		ctx:      req.Context(),
+		scrape:   NewScrape(req),
+	}
+}
+
+func (s scrapeExporter) Collect(metricsChannel chan<- prometheus.Metric) {
+	s.CollectScrape(s.ctx, s.scrape, metricsChannel)
+}
+
+// Serve metrics of the exporter along with the ones of the default registry.
+// The exporter is registered for each request to know about the scrape.
+func MetricsHandler(e *Exporter) http.Handler {
+	return promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer,
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(newScrapeExporter(e, req))
+
+			gatherers := prometheus.Gatherers{prometheus.DefaultGatherer, registry}
+			promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}).ServeHTTP(w, req)
+		}),
+	)
+}
@@ -0,0 +1,55 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/claranet/wallix_bastion_exporter/config"
+	"github.com/claranet/wallix_bastion_exporter/wallix"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var metricInfo = prometheus.NewDesc(
+	prometheus.BuildFQName(Namespace, "", "info"),
+	"Versions of the Wallix Bastion and its API, always 1.",
+	[]string{"version", "api_version", "hostname"}, nil,
+)
+
+type infoCollector struct{}
+
+func init() {
+	registerCollector("info", true, newInfoCollector)
+}
+
+func newInfoCollector(_ config.Config, _ log.Logger) Collector {
+	return &infoCollector{}
+}
+
+func (c *infoCollector) Update(
+	ctx context.Context, _ Scrape, metricsChannel chan<- prometheus.Metric, client *wallix.Client,
+) error {
+	versionInfo, err := client.GetVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot get version information: %w", err)
+	}
+
+	// The complete version with build number is not returned by older versions
+	version := versionInfo.WabCompleteVersion
+	if version == "" {
+		version = versionInfo.WabVersion
+	}
+	// The API does not return the bastion name, so the host requested is used
+	var hostname string
+	if apiURL, err := url.Parse(client.URL); err == nil {
+		hostname = apiURL.Hostname()
+	}
+
+	metricsChannel <- prometheus.MustNewConstMetric(
+		metricInfo, prometheus.GaugeValue, 1,
+		version, versionInfo.Version, hostname,
+	)
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package exporter
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/version"
+)
+
+// Prefix of metrics about the exporter itself rather than the bastion.
+const selfNamespace = Namespace + "_exporter"
+
+var (
+	metricAPIRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: selfNamespace,
+			Name:      "api_requests_total",
+			Help:      "Total number of requests to Wallix Bastion API by endpoint and status code, 0 if no response.",
+		},
+		[]string{"endpoint", "status_code"},
+	)
+	metricAPIRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: selfNamespace,
+			Name:      "api_request_duration_seconds",
+			Help:      "Duration of requests to Wallix Bastion API by endpoint.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"endpoint"},
+	)
+	metricAuthenticationFailures = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: selfNamespace,
+			Name:      "authentication_failures_total",
+			Help:      "Total number of failed authentications to Wallix Bastion API.",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(
+		version.NewCollector(selfNamespace),
+		metricAPIRequests,
+		metricAPIRequestDuration,
+		metricAuthenticationFailures,
+	)
+}
+
+// Instrument the requests of all clients to the API.
+type apiObserver struct{}
+
+func (apiObserver) ObserveRequest(endpoint string, statusCode int, duration time.Duration) {
+	metricAPIRequests.WithLabelValues(endpoint, strconv.Itoa(statusCode)).Inc()
+	metricAPIRequestDuration.WithLabelValues(endpoint).Observe(duration.Seconds())
+}
+
+func (apiObserver) ObserveAuthenticationFailure(_ error) {
+	metricAuthenticationFailures.Inc()
+}
@@ -0,0 +1,154 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/claranet/wallix_bastion_exporter/config"
+	"github.com/claranet/wallix_bastion_exporter/wallix"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	metricLicenseIsExpired = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "", "license_is_expired"),
+		"Is the Wallix is expired (0=false, 1=true).",
+		nil, nil,
+	)
+	metricLicensePrimaryPct = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "", "license_primary_ratio"),
+		"License usage percentage of primary.",
+		nil, nil,
+	)
+	metricLicenseSecondaryPct = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "", "license_secondary_ratio"),
+		"License usage percentage of secondary.",
+		nil, nil,
+	)
+	metricLicenseNameUserPct = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "", "license_named_user_ratio"),
+		"License usage percentage of named user.",
+		nil, nil,
+	)
+	metricLicenseResourcePct = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "", "license_resource_ratio"),
+		"License usage percentage of resource.",
+		nil, nil,
+	)
+	metricLicenseWaapmPct = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "", "license_waapm_ratio"),
+		"License usage percentage of waapm.",
+		nil, nil,
+	)
+	metricLicensePmTargetPct = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "", "license_pm_target_ratio"),
+		"License usage percentage of pm target.",
+		nil, nil,
+	)
+	metricLicenseSmTargetPct = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "", "license_sm_target_ratio"),
+		"License usage percentage of sm target.",
+		nil, nil,
+	)
+	metricLicenseExpiration = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "", "license_expiration_timestamp_seconds"),
+		"Timestamp of the license expiration date.",
+		nil, nil,
+	)
+	metricLicenseInfo = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "", "license_info"),
+		"License metadata, always 1.",
+		[]string{"type", "customer", "features"}, nil,
+	)
+)
+
+type licenseCollector struct {
+	logger log.Logger
+}
+
+func init() {
+	registerCollector("license", true, newLicenseCollector)
+}
+
+func newLicenseCollector(_ config.Config, logger log.Logger) Collector {
+	return &licenseCollector{logger: logger}
+}
+
+func (c *licenseCollector) Update(
+	ctx context.Context, _ Scrape, metricsChannel chan<- prometheus.Metric, client *wallix.Client,
+) error {
+	licenseInfo, err := client.GetLicense(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot get license information: %w", err)
+	}
+
+	// Depending on the version, the API returns whether the license is expired or valid
+	var licenseIsExpiredGauge int8
+	switch {
+	case licenseInfo.IsExpired != nil:
+		if *licenseInfo.IsExpired {
+			licenseIsExpiredGauge = 1
+		}
+		metricsChannel <- prometheus.MustNewConstMetric(
+			metricLicenseIsExpired, prometheus.GaugeValue, float64(licenseIsExpiredGauge),
+		)
+	case licenseInfo.IsValid != nil:
+		if !*licenseInfo.IsValid {
+			licenseIsExpiredGauge = 1
+		}
+		metricsChannel <- prometheus.MustNewConstMetric(
+			metricLicenseIsExpired, prometheus.GaugeValue, float64(licenseIsExpiredGauge),
+		)
+	}
+
+	// Metadata in an unexpected format only prevents their own metrics.
+	// The expiration is only sent when the API returns a date, not for a license without expiration.
+	expiration, err := licenseInfo.Expiration()
+	switch {
+	case err != nil:
+		level.Warn(c.logger).Log("msg", "skip license expiration", "err", err)
+	case !expiration.IsZero():
+		metricsChannel <- prometheus.MustNewConstMetric(
+			metricLicenseExpiration, prometheus.GaugeValue, float64(expiration.Unix()),
+		)
+	}
+
+	metadata, err := licenseInfo.Metadata()
+	if err != nil {
+		level.Warn(c.logger).Log("msg", "skip license metadata", "err", err)
+	} else {
+		sort.Strings(metadata.Features)
+		metricsChannel <- prometheus.MustNewConstMetric(
+			metricLicenseInfo, prometheus.GaugeValue, 1,
+			metadata.Type, metadata.Customer, strings.Join(metadata.Features, ","),
+		)
+	}
+
+	// Ratios are only sent when the maximum is known
+	ratios := []struct {
+		desc  *prometheus.Desc
+		usage float64
+		max   *float64
+	}{
+		{metricLicensePrimaryPct, licenseInfo.Primary, licenseInfo.PrimaryMax},
+		{metricLicenseSecondaryPct, licenseInfo.Secondary, licenseInfo.SecondaryMax},
+		{metricLicenseNameUserPct, licenseInfo.NamedUser, licenseInfo.NamedUserMax},
+		{metricLicenseResourcePct, licenseInfo.Resource, licenseInfo.ResourceMax},
+		{metricLicenseWaapmPct, licenseInfo.Waapm, licenseInfo.WaapmMax},
+		{metricLicensePmTargetPct, licenseInfo.PmTarget, licenseInfo.PmTargetMax},
+		{metricLicenseSmTargetPct, licenseInfo.SmTarget, licenseInfo.SmTargetMax},
+	}
+	for _, ratio := range ratios {
+		if ratio.max != nil {
+			metricsChannel <- prometheus.MustNewConstMetric(
+				ratio.desc, prometheus.GaugeValue, ratio.usage/(*ratio.max),
+			)
+		}
+	}
+
+	return nil
+}
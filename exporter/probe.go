@@ -0,0 +1,53 @@
+package exporter
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/claranet/wallix_bastion_exporter/config"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Serve metrics of the bastion given by the "target" query parameter
+// using the settings of the module given by the "module" query parameter.
+// A dedicated exporter and registry are built for each request.
+func ProbeHandler(cfg config.Config, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		params := req.URL.Query()
+
+		target := params.Get("target")
+		if target == "" {
+			http.Error(w, "target parameter is missing", http.StatusBadRequest)
+
+			return
+		}
+
+		targetConfig, err := cfg.ForTarget(target, params.Get("module"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		targetLogger := log.With(logger, "target", target, "module", params.Get("module"))
+		targetExporter, err := NewExporter(targetConfig, targetLogger)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+		// The exporter only lives for this probe, so the session is closed right after
+		defer func() {
+			if err := targetExporter.Close(context.Background()); err != nil {
+				level.Warn(targetLogger).Log("msg", "cannot close session after probe", "err", err)
+			}
+		}()
+
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(newScrapeExporter(targetExporter, req))
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, req)
+	}
+}
@@ -0,0 +1,77 @@
+package exporter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics gathered by the last background refresh.
+type snapshot struct {
+	mutex     sync.RWMutex
+	metrics   []prometheus.Metric
+	timestamp time.Time
+}
+
+// Refresh metrics in background at each interval until the context is done.
+// Once started, Collect only serves the last snapshot without requesting the API.
+func (e *Exporter) StartRefresh(ctx context.Context, interval time.Duration) {
+	e.snapshot = &snapshot{}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			e.refresh(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Gather all metrics from the API and replace the current snapshot.
+func (e *Exporter) refresh(ctx context.Context) {
+	metricsChannel := make(chan prometheus.Metric)
+	metrics := []prometheus.Metric{}
+	done := make(chan struct{})
+
+	go func() {
+		for metric := range metricsChannel {
+			metrics = append(metrics, metric)
+		}
+		close(done)
+	}()
+
+	e.collect(ctx, Scrape{}, metricsChannel)
+	close(metricsChannel)
+	<-done
+
+	e.snapshot.mutex.Lock()
+	e.snapshot.metrics = metrics
+	e.snapshot.timestamp = time.Now()
+	e.snapshot.mutex.Unlock()
+}
+
+// Send the metrics of the last snapshot, nothing until the first refresh is done.
+func (e *Exporter) serveSnapshot(metricsChannel chan<- prometheus.Metric) {
+	e.snapshot.mutex.RLock()
+	defer e.snapshot.mutex.RUnlock()
+
+	if e.snapshot.timestamp.IsZero() {
+		return
+	}
+
+	for _, metric := range e.snapshot.metrics {
+		metricsChannel <- metric
+	}
+	metricsChannel <- prometheus.MustNewConstMetric(
+		metricLastRefresh, prometheus.GaugeValue, float64(e.snapshot.timestamp.Unix()),
+	)
+}
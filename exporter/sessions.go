@@ -0,0 +1,303 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/claranet/wallix_bastion_exporter/config"
+	"github.com/claranet/wallix_bastion_exporter/wallix"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	metricSessions = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "", "sessions"),
+		"Number of sessions, closed ones are counted over the closed sessions window.",
+		[]string{"status", "protocol"}, nil,
+	)
+	metricSessionsByDevice = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "", "sessions_by_device"),
+		"Number of current sessions per target device.",
+		[]string{"device"}, nil,
+	)
+	metricSessionsByUserGroup = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "", "sessions_by_user_group"),
+		"Number of current sessions per user group.",
+		[]string{"user_group"}, nil,
+	)
+	metricSessionsStartedTotal = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "", "sessions_started_total"),
+		"Total number of sessions started.",
+		nil, nil,
+	)
+	metricSessionsClosedTotal = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "", "sessions_closed_total"),
+		"Total number of sessions closed.",
+		nil, nil,
+	)
+	metricSessionsClosedWindow = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "", "sessions_closed_window_seconds"),
+		"Timeframe over which closed sessions are counted.",
+		nil, nil,
+	)
+)
+
+type sessionsCollector struct {
+	window      time.Duration
+	windowMode  string
+	stateFile   string
+	byDevice    bool
+	byUserGroup bool
+	// Maximum number of label values for breakdowns.
+	breakdownLimit int
+	// Upper bounds in seconds of the sessions duration histogram.
+	durationBuckets []float64
+	ageThresholds   []time.Duration
+	ageByTarget     bool
+	// Descriptions depending on whether ages are labelled by target.
+	metricOldestAge   *prometheus.Desc
+	metricLongRunning *prometheus.Desc
+	// End of the timeframe of the last successful closed sessions request.
+	lastClosed time.Time
+	// Sessions already counted, nil until a first baseline is known.
+	state  *sessionsState
+	mutex  sync.Mutex
+	logger log.Logger
+}
+
+func init() {
+	registerCollector("sessions", true, newSessionsCollector)
+}
+
+func newSessionsCollector(cfg config.Config, logger log.Logger) Collector {
+	collector := &sessionsCollector{
+		window:         time.Duration(cfg.SessionsClosedWindow) * time.Second,
+		windowMode:     cfg.SessionsClosedWindowMode,
+		stateFile:      cfg.SessionsStateFile,
+		byDevice:       cfg.SessionsByDevice,
+		byUserGroup:    cfg.SessionsByUserGroup,
+		breakdownLimit: cfg.SessionsBreakdownLimit,
+		logger:         logger,
+	}
+	for _, bucket := range cfg.SessionsDurationBuckets {
+		collector.durationBuckets = append(collector.durationBuckets, float64(bucket))
+	}
+	sort.Float64s(collector.durationBuckets)
+	for _, threshold := range cfg.SessionsAgeThresholds {
+		collector.ageThresholds = append(collector.ageThresholds, time.Duration(threshold)*time.Second)
+	}
+	collector.ageByTarget = cfg.SessionsAgeByTarget
+	collector.metricOldestAge, collector.metricLongRunning = newSessionsAgeDescs(collector.ageByTarget)
+
+	if collector.stateFile != "" {
+		state, err := loadSessionsState(collector.stateFile)
+		if err != nil {
+			level.Warn(logger).Log("msg", "sessions counters start from scratch", "file", collector.stateFile, "err", err)
+		}
+		if state != nil {
+			if state.Durations == nil {
+				state.Durations = map[string]*durationHistogram{}
+			}
+			collector.state = state
+			collector.lastClosed = state.LastClosed
+		}
+	}
+
+	return collector
+}
+
+func (c *sessionsCollector) Update(
+	ctx context.Context, scrape Scrape, metricsChannel chan<- prometheus.Metric, client *wallix.Client,
+) error {
+	// Closed sessions are fetched even if current sessions failed
+	sessionsCurrent, errCurrent := client.GetCurrentSessions(ctx)
+	if errCurrent == nil {
+		c.sendBreakdowns(metricsChannel, sessionsCurrent)
+		c.sendAges(metricsChannel, sessionsCurrent, time.Now())
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	window := c.closedWindow(scrape, now)
+	from := now.Add(-window)
+	// Counters resume from the last sessions counted, even before the window, so sessions closed
+	// between two counts are never missed, the ones already counted are ignored by ID
+	countFrom := from
+	if c.state != nil && !c.state.LastClosed.IsZero() && c.state.LastClosed.Before(from) {
+		countFrom = c.state.LastClosed
+	}
+	sessionsClosed, errClosed := client.GetClosedSessions(ctx, countFrom)
+	if errClosed == nil {
+		for protocol, count := range countSessionsByProtocol(closedSince(sessionsClosed, from)) {
+			metricsChannel <- prometheus.MustNewConstMetric(
+				metricSessions, prometheus.GaugeValue, count, "closed", protocol,
+			)
+		}
+		metricsChannel <- prometheus.MustNewConstMetric(
+			metricSessionsClosedWindow, prometheus.GaugeValue, window.Seconds(),
+		)
+	}
+
+	// Sessions are only known to be counted up to now when both requests succeeded
+	if errCurrent == nil && errClosed == nil {
+		c.lastClosed = now
+		c.countSessions(metricsChannel, sessionsCurrent, sessionsClosed, now, countFrom.Add(-window))
+	}
+
+	// ch <- prometheus.MustNewConstMetric(
+	// 	sessions, prometheus.GaugeValue, float64(
+	// 		len(sessionsClosedResults)+len(sessionsCurrentResults),
+	// 	),
+	// )
+
+	var errors collectorErrors
+	if errCurrent != nil {
+		errors = append(errors, fmt.Errorf("cannot get current sessions: %w", errCurrent))
+	}
+	if errClosed != nil {
+		errors = append(errors, fmt.Errorf("cannot get closed sessions: %w", errClosed))
+	}
+	if len(errors) > 0 {
+		return errors
+	}
+
+	return nil
+}
+
+// Send the number of current sessions per protocol and the opt-in breakdowns.
+func (c *sessionsCollector) sendBreakdowns(
+	metricsChannel chan<- prometheus.Metric, sessionsCurrent []wallix.Session,
+) {
+	for protocol, count := range countSessionsByProtocol(sessionsCurrent) {
+		metricsChannel <- prometheus.MustNewConstMetric(
+			metricSessions, prometheus.GaugeValue, count, "current", protocol,
+		)
+	}
+
+	if c.byDevice {
+		devices := capBreakdown(countSessionsBy(sessionsCurrent, func(session wallix.Session) string {
+			return session.TargetDevice
+		}), c.breakdownLimit)
+		for device, count := range devices {
+			metricsChannel <- prometheus.MustNewConstMetric(
+				metricSessionsByDevice, prometheus.GaugeValue, count, device,
+			)
+		}
+	}
+
+	if c.byUserGroup {
+		userGroups := capBreakdown(countSessionsBy(sessionsCurrent, func(session wallix.Session) string {
+			return session.UserGroup
+		}), c.breakdownLimit)
+		for userGroup, count := range userGroups {
+			metricsChannel <- prometheus.MustNewConstMetric(
+				metricSessionsByUserGroup, prometheus.GaugeValue, count, userGroup,
+			)
+		}
+	}
+}
+
+// Determine the timeframe to count closed sessions depending on the window mode.
+// It falls back to the fixed window when the mode cannot apply.
+func (c *sessionsCollector) closedWindow(scrape Scrape, now time.Time) time.Duration {
+	switch c.windowMode {
+	case config.SessionsClosedWindowScrapeTimeout:
+		if scrape.Timeout > 0 {
+			return scrape.Timeout
+		}
+	case config.SessionsClosedWindowLastScrape:
+		if !c.lastClosed.IsZero() {
+			return now.Sub(c.lastClosed)
+		}
+	}
+
+	return c.window
+}
+
+// Update counters of started and closed sessions from the sessions returned by the API.
+// Sessions not seen since the prune date are forgotten.
+func (c *sessionsCollector) countSessions(
+	metricsChannel chan<- prometheus.Metric,
+	sessionsCurrent []wallix.Session,
+	sessionsClosed []wallix.Session,
+	now time.Time,
+	pruneBefore time.Time,
+) {
+	if c.state == nil {
+		// The first sessions are only a baseline, counters are sent from the next update
+		c.state = newSessionsState()
+		c.state.track(sessionIDs(sessionsCurrent), sessionIDs(sessionsClosed), now)
+		c.state.StartedTotal, c.state.ClosedTotal = 0, 0
+	} else {
+		newlyClosedIDs := c.state.track(sessionIDs(sessionsCurrent), sessionIDs(sessionsClosed), now)
+		c.observeDurations(newlyClosedIDs, sessionsClosed)
+
+		metricsChannel <- prometheus.MustNewConstMetric(
+			metricSessionsStartedTotal, prometheus.CounterValue, c.state.StartedTotal,
+		)
+		metricsChannel <- prometheus.MustNewConstMetric(
+			metricSessionsClosedTotal, prometheus.CounterValue, c.state.ClosedTotal,
+		)
+		for protocol, histogram := range c.state.Durations {
+			if histogram.hasBuckets(c.durationBuckets) {
+				metricsChannel <- histogram.metric(protocol)
+			}
+		}
+	}
+	c.state.prune(pruneBefore)
+	c.state.LastClosed = c.lastClosed
+
+	if c.stateFile != "" {
+		if err := c.state.save(c.stateFile); err != nil {
+			level.Warn(c.logger).Log("msg", "cannot persist sessions counters", "file", c.stateFile, "err", err)
+		}
+	}
+}
+
+// Observe the duration of the sessions newly counted as closed.
+func (c *sessionsCollector) observeDurations(newlyClosedIDs []string, sessionsClosed []wallix.Session) {
+	if len(newlyClosedIDs) == 0 {
+		return
+	}
+
+	sessionsByID := make(map[string]wallix.Session, len(sessionsClosed))
+	for _, session := range sessionsClosed {
+		sessionsByID[session.ID] = session
+	}
+
+	for _, id := range newlyClosedIDs {
+		session := sessionsByID[id]
+		if seconds, ok := sessionDuration(session); ok {
+			c.state.observeDuration(session.TargetProtocol, seconds, c.durationBuckets)
+		}
+	}
+}
+
+// Sessions closed since the date, at the precision of the API, or without end date.
+func closedSince(sessions []wallix.Session, from time.Time) []wallix.Session {
+	from = from.Truncate(time.Second)
+	closed := make([]wallix.Session, 0, len(sessions))
+	for _, session := range sessions {
+		if session.End.IsZero() || !session.End.Before(from) {
+			closed = append(closed, session)
+		}
+	}
+
+	return closed
+}
+
+func sessionIDs(sessions []wallix.Session) []string {
+	ids := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+	}
+
+	return ids
+}
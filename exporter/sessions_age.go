@@ -0,0 +1,109 @@
+package exporter
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/claranet/wallix_bastion_exporter/wallix"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Labels of sessions age metrics, by target or not depending on configuration.
+type sessionsAgeKey struct {
+	protocol string
+	device   string
+}
+
+// Build descriptions of sessions age metrics with target labels if enabled.
+func newSessionsAgeDescs(byTarget bool) (oldestAge *prometheus.Desc, longRunning *prometheus.Desc) {
+	var labels []string
+	if byTarget {
+		labels = []string{"protocol", "device"}
+	}
+
+	oldestAge = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "", "session_oldest_age_seconds"),
+		"Age of the oldest current session.",
+		labels, nil,
+	)
+	longRunning = prometheus.NewDesc(
+		prometheus.BuildFQName(Namespace, "", "sessions_long_running"),
+		"Number of current sessions open for longer than the threshold in seconds.",
+		append([]string{"threshold"}, labels...), nil,
+	)
+
+	return oldestAge, longRunning
+}
+
+// Send the age of the oldest current session and the number of sessions exceeding each threshold.
+func (c *sessionsCollector) sendAges(
+	metricsChannel chan<- prometheus.Metric, sessionsCurrent []wallix.Session, now time.Time,
+) {
+	oldestAges := map[sessionsAgeKey]float64{}
+	longRunning := map[sessionsAgeKey][]float64{}
+	if !c.ageByTarget {
+		// Always send unlabelled metrics even without session
+		oldestAges[sessionsAgeKey{}] = 0
+		longRunning[sessionsAgeKey{}] = make([]float64, len(c.ageThresholds))
+	}
+
+	// Devices with the fewest sessions are aggregated like in breakdowns to bound the cardinality
+	var devices map[string]float64
+	if c.ageByTarget {
+		devices = capBreakdown(countSessionsBy(sessionsCurrent, func(session wallix.Session) string {
+			return session.TargetDevice
+		}), c.breakdownLimit)
+	}
+
+	for _, session := range sessionsCurrent {
+		if session.Begin.IsZero() {
+			continue
+		}
+		age := now.Sub(session.Begin.Time)
+
+		var key sessionsAgeKey
+		if c.ageByTarget {
+			key = sessionsAgeKey{
+				protocol: session.TargetProtocol,
+				device:   session.TargetDevice,
+			}
+			if _, ok := devices[key.device]; !ok {
+				key.device = breakdownOther
+			}
+		}
+
+		if age.Seconds() > oldestAges[key] {
+			oldestAges[key] = age.Seconds()
+		}
+		if _, ok := longRunning[key]; !ok {
+			longRunning[key] = make([]float64, len(c.ageThresholds))
+		}
+		for i, threshold := range c.ageThresholds {
+			if age > threshold {
+				longRunning[key][i]++
+			}
+		}
+	}
+
+	for key, oldestAge := range oldestAges {
+		metricsChannel <- prometheus.MustNewConstMetric(
+			c.metricOldestAge, prometheus.GaugeValue, oldestAge, key.labels(c.ageByTarget)...,
+		)
+	}
+	for key, counts := range longRunning {
+		for i, threshold := range c.ageThresholds {
+			labels := append([]string{strconv.FormatFloat(threshold.Seconds(), 'f', -1, 64)}, key.labels(c.ageByTarget)...)
+			metricsChannel <- prometheus.MustNewConstMetric(
+				c.metricLongRunning, prometheus.GaugeValue, counts[i], labels...,
+			)
+		}
+	}
+}
+
+func (k sessionsAgeKey) labels(byTarget bool) []string {
+	if !byTarget {
+		return nil
+	}
+
+	return []string{k.protocol, k.device}
+}
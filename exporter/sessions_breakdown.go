@@ -0,0 +1,67 @@
+package exporter
+
+import (
+	"sort"
+
+	"github.com/claranet/wallix_bastion_exporter/wallix"
+)
+
+// Label value aggregating sessions beyond the breakdown limit.
+const breakdownOther = "other"
+
+// Protocols always reported, even without session, so series do not vanish.
+var sessionsProtocols = []string{"SSH", "RDP", "VNC", "TELNET", "RLOGIN", "RAWTCPIP"}
+
+// Count sessions by protocol including known protocols without session.
+func countSessionsByProtocol(sessions []wallix.Session) map[string]float64 {
+	counts := countSessionsBy(sessions, func(session wallix.Session) string {
+		return session.TargetProtocol
+	})
+	for _, protocol := range sessionsProtocols {
+		if _, ok := counts[protocol]; !ok {
+			counts[protocol] = 0
+		}
+	}
+
+	return counts
+}
+
+// Count sessions by the value of a field, missing values are counted as empty.
+func countSessionsBy(sessions []wallix.Session, field func(wallix.Session) string) map[string]float64 {
+	counts := map[string]float64{}
+	for _, session := range sessions {
+		counts[field(session)]++
+	}
+
+	return counts
+}
+
+// Keep the limit highest counts and aggregate the others to cap the cardinality.
+func capBreakdown(counts map[string]float64, limit int) map[string]float64 {
+	if limit <= 0 || len(counts) <= limit {
+		return counts
+	}
+
+	values := make([]string, 0, len(counts))
+	for value := range counts {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if counts[values[i]] == counts[values[j]] {
+			return values[i] < values[j]
+		}
+
+		return counts[values[i]] > counts[values[j]]
+	})
+
+	capped := make(map[string]float64, limit+1)
+	for i, value := range values {
+		if i < limit {
+			capped[value] = counts[value]
+		} else {
+			capped[breakdownOther] += counts[value]
+		}
+	}
+
+	return capped
+}
@@ -0,0 +1,72 @@
+package exporter
+
+import (
+	"github.com/claranet/wallix_bastion_exporter/wallix"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var metricSessionDuration = prometheus.NewDesc(
+	prometheus.BuildFQName(Namespace, "", "session_duration_seconds"),
+	"Duration of closed sessions.",
+	[]string{"protocol"}, nil,
+)
+
+// Cumulative histogram of sessions duration, persisted with the sessions state.
+type durationHistogram struct {
+	// Upper bounds of buckets in seconds.
+	Buckets []float64 `json:"buckets"`
+	Counts  []uint64  `json:"counts"`
+	Count   uint64    `json:"count"`
+	Sum     float64   `json:"sum"`
+}
+
+func newDurationHistogram(buckets []float64) *durationHistogram {
+	return &durationHistogram{
+		Buckets: buckets,
+		Counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *durationHistogram) observe(seconds float64) {
+	for i, bucket := range h.Buckets {
+		if seconds <= bucket {
+			h.Counts[i]++
+		}
+	}
+	h.Count++
+	h.Sum += seconds
+}
+
+func (h *durationHistogram) metric(protocol string) prometheus.Metric {
+	buckets := make(map[float64]uint64, len(h.Buckets))
+	for i, bucket := range h.Buckets {
+		buckets[bucket] = h.Counts[i]
+	}
+
+	return prometheus.MustNewConstHistogram(
+		metricSessionDuration, h.Count, h.Sum, buckets, protocol,
+	)
+}
+
+// Whether the histogram was built with the same buckets.
+func (h *durationHistogram) hasBuckets(buckets []float64) bool {
+	if len(h.Buckets) != len(buckets) || len(h.Counts) != len(buckets) {
+		return false
+	}
+	for i, bucket := range buckets {
+		if h.Buckets[i] != bucket {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Duration of a closed session from its begin and end dates.
+func sessionDuration(session wallix.Session) (seconds float64, ok bool) {
+	if session.Begin.IsZero() || session.End.IsZero() || session.End.Before(session.Begin.Time) {
+		return 0, false
+	}
+
+	return session.End.Sub(session.Begin.Time).Seconds(), true
+}
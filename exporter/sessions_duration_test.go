@@ -0,0 +1,119 @@
+package exporter
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/claranet/wallix_bastion_exporter/wallix"
+)
+
+func TestDurationHistogramObserve(t *testing.T) {
+	histogram := newDurationHistogram([]float64{60, 3600})
+
+	for _, seconds := range []float64{30, 60, 600, 7200} {
+		histogram.observe(seconds)
+	}
+
+	// Buckets are cumulative and the upper bound is inclusive
+	if !reflect.DeepEqual(histogram.Counts, []uint64{2, 3}) {
+		t.Errorf("counts = %v, want [2 3]", histogram.Counts)
+	}
+	if histogram.Count != 4 || histogram.Sum != 7890 {
+		t.Errorf("count = %d, sum = %v, want 4 and 7890", histogram.Count, histogram.Sum)
+	}
+}
+
+func TestDurationHistogramHasBuckets(t *testing.T) {
+	histogram := newDurationHistogram([]float64{60, 3600})
+
+	tests := []struct {
+		buckets []float64
+		want    bool
+	}{
+		{[]float64{60, 3600}, true},
+		{[]float64{60, 7200}, false},
+		{[]float64{60}, false},
+		{nil, false},
+	}
+	for _, test := range tests {
+		if got := histogram.hasBuckets(test.buckets); got != test.want {
+			t.Errorf("hasBuckets(%v) = %v, want %v", test.buckets, got, test.want)
+		}
+	}
+
+	// A persisted histogram with inconsistent counts is not reused
+	histogram.Counts = histogram.Counts[:1]
+	if histogram.hasBuckets([]float64{60, 3600}) {
+		t.Error("hasBuckets() = true with fewer counts than buckets")
+	}
+}
+
+func TestObserveDurationResetOnBucketsChange(t *testing.T) {
+	state := newSessionsState()
+
+	state.observeDuration("SSH", 30, []float64{60, 3600})
+	state.observeDuration("SSH", 600, []float64{60, 3600})
+	state.observeDuration("RDP", 30, []float64{60, 3600})
+	if histogram := state.Durations["SSH"]; histogram.Count != 2 {
+		t.Fatalf("SSH count = %d, want 2", histogram.Count)
+	}
+
+	// New buckets from the configuration start a new histogram for the protocol observed
+	state.observeDuration("SSH", 120, []float64{300})
+	histogram := state.Durations["SSH"]
+	if !reflect.DeepEqual(histogram.Buckets, []float64{300}) || histogram.Count != 1 ||
+		!reflect.DeepEqual(histogram.Counts, []uint64{1}) || histogram.Sum != 120 {
+		t.Errorf("SSH histogram = %+v, want a new histogram with only the last observation", histogram)
+	}
+	if state.Durations["RDP"].Count != 1 {
+		t.Errorf("RDP histogram = %+v, want it untouched", state.Durations["RDP"])
+	}
+}
+
+func sessionBetween(begin time.Time, end time.Time) wallix.Session {
+	return wallix.Session{Begin: wallix.Time{Time: begin}, End: wallix.Time{Time: end}}
+}
+
+func TestSessionDuration(t *testing.T) {
+	begin := time.Date(2021, 9, 1, 10, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name    string
+		session wallix.Session
+		want    float64
+		wantOK  bool
+	}{
+		{"closed", sessionBetween(begin, begin.Add(time.Hour)), 3600, true},
+		{"no end", sessionBetween(begin, time.Time{}), 0, false},
+		{"no begin", sessionBetween(time.Time{}, begin), 0, false},
+		{"end before begin", sessionBetween(begin, begin.Add(-time.Minute)), 0, false},
+	}
+	for _, test := range tests {
+		got, ok := sessionDuration(test.session)
+		if got != test.want || ok != test.wantOK {
+			t.Errorf("%s: sessionDuration() = %v, %v, want %v, %v", test.name, got, ok, test.want, test.wantOK)
+		}
+	}
+}
+
+func TestCountSessionsObservesNewlyClosedOnce(t *testing.T) {
+	collector := newTestSessionsCollector()
+	now := time.Now()
+	collector.state = newSessionsState()
+	closed := []wallix.Session{{
+		ID:             "a",
+		Begin:          wallix.Time{Time: now.Add(-10 * time.Minute)},
+		End:            wallix.Time{Time: now.Add(-time.Minute)},
+		TargetProtocol: "SSH",
+	}}
+
+	// The same closed session is returned by overlapping requests
+	countSessions(collector, nil, closed, now, now.Add(-time.Hour))
+	countSessions(collector, nil, closed, now.Add(time.Minute), now.Add(-time.Hour))
+
+	histogram := collector.state.Durations["SSH"]
+	if histogram == nil || histogram.Count != 1 || histogram.Sum != 540 {
+		t.Errorf("duration histogram = %+v, want the session observed once", histogram)
+	}
+}
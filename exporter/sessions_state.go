@@ -0,0 +1,130 @@
+package exporter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Sessions already counted by the sessions collector. It is persisted to a local file,
+// if configured, so counters are neither reset nor counted twice across restarts.
+type sessionsState struct {
+	StartedTotal float64 `json:"started_total"`
+	ClosedTotal  float64 `json:"closed_total"`
+	// End of the timeframe of the last closed sessions request.
+	LastClosed time.Time `json:"last_closed"`
+	// Last time each session was seen by session ID.
+	Started map[string]time.Time `json:"started"`
+	Closed  map[string]time.Time `json:"closed"`
+	// Duration of closed sessions by protocol.
+	Durations map[string]*durationHistogram `json:"durations"`
+}
+
+func newSessionsState() *sessionsState {
+	return &sessionsState{
+		Started:   map[string]time.Time{},
+		Closed:    map[string]time.Time{},
+		Durations: map[string]*durationHistogram{},
+	}
+}
+
+// Read the state from the file, nil if there is no file yet.
+func loadSessionsState(path string) (*sessionsState, error) {
+	content, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil //nolint:nilnil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read sessions state file: %w", err)
+	}
+
+	state := newSessionsState()
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, fmt.Errorf("cannot decode sessions state file %s: %w", path, err)
+	}
+
+	return state, nil
+}
+
+// Write the state to the file through a temporary file to never leave it truncated.
+func (s *sessionsState) save(path string) error {
+	content, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("cannot encode sessions state: %w", err)
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("cannot create sessions state file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+
+		return fmt.Errorf("cannot write sessions state file: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("cannot write sessions state file: %w", err)
+	}
+
+	if err := os.Rename(tmpFile.Name(), path); err != nil {
+		return fmt.Errorf("cannot replace sessions state file: %w", err)
+	}
+
+	return nil
+}
+
+// Count sessions not seen before as started, and closed ones not counted yet as closed.
+// Closed sessions never seen as current are also counted as started.
+// It returns the IDs of sessions newly counted as closed.
+func (s *sessionsState) track(currentIDs []string, closedIDs []string, now time.Time) (newlyClosedIDs []string) {
+	for _, id := range currentIDs {
+		if _, ok := s.Started[id]; !ok {
+			s.StartedTotal++
+		}
+		s.Started[id] = now
+	}
+
+	for _, id := range closedIDs {
+		if _, ok := s.Closed[id]; !ok {
+			s.ClosedTotal++
+			newlyClosedIDs = append(newlyClosedIDs, id)
+			if _, ok := s.Started[id]; !ok {
+				s.StartedTotal++
+			}
+		}
+		delete(s.Started, id)
+		s.Closed[id] = now
+	}
+
+	return newlyClosedIDs
+}
+
+// Add the duration of a closed session to the histogram of its protocol.
+func (s *sessionsState) observeDuration(protocol string, seconds float64, buckets []float64) {
+	histogram, ok := s.Durations[protocol]
+	if !ok || !histogram.hasBuckets(buckets) {
+		histogram = newDurationHistogram(buckets)
+		s.Durations[protocol] = histogram
+	}
+	histogram.observe(seconds)
+}
+
+// Forget sessions not seen since the given date as they cannot be returned by the API anymore.
+func (s *sessionsState) prune(before time.Time) {
+	for id, seen := range s.Started {
+		if seen.Before(before) {
+			delete(s.Started, id)
+		}
+	}
+	for id, seen := range s.Closed {
+		if seen.Before(before) {
+			delete(s.Closed, id)
+		}
+	}
+}
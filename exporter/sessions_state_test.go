@@ -0,0 +1,159 @@
+package exporter
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/claranet/wallix_bastion_exporter/config"
+	"github.com/claranet/wallix_bastion_exporter/wallix"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func sessionsWithIDs(ids ...string) []wallix.Session {
+	sessions := make([]wallix.Session, 0, len(ids))
+	for _, id := range ids {
+		sessions = append(sessions, wallix.Session{ID: id, TargetProtocol: "SSH"})
+	}
+
+	return sessions
+}
+
+func assertTotals(t *testing.T, state *sessionsState, started float64, closed float64) {
+	t.Helper()
+	if state.StartedTotal != started || state.ClosedTotal != closed {
+		t.Errorf("totals = started %v, closed %v, want started %v, closed %v",
+			state.StartedTotal, state.ClosedTotal, started, closed)
+	}
+}
+
+// Collect the metrics sent by countSessions.
+func countSessions(
+	c *sessionsCollector, current []wallix.Session, closed []wallix.Session, now time.Time, pruneBefore time.Time,
+) []prometheus.Metric {
+	metricsChannel := make(chan prometheus.Metric, 100)
+	c.countSessions(metricsChannel, current, closed, now, pruneBefore)
+	close(metricsChannel)
+
+	metrics := []prometheus.Metric{}
+	for metric := range metricsChannel {
+		metrics = append(metrics, metric)
+	}
+
+	return metrics
+}
+
+func TestCountSessionsBaseline(t *testing.T) {
+	collector := &sessionsCollector{logger: log.NewNopLogger()}
+	now := time.Now()
+
+	metrics := countSessions(collector, sessionsWithIDs("a", "b"), sessionsWithIDs("c"), now, now.Add(-time.Hour))
+	if len(metrics) != 0 {
+		t.Errorf("baseline sent %d metrics, want none", len(metrics))
+	}
+	assertTotals(t, collector.state, 0, 0)
+
+	// b is closed and d is started, a and c were already counted in the baseline
+	now = now.Add(time.Minute)
+	metrics = countSessions(collector, sessionsWithIDs("a", "d"), sessionsWithIDs("b", "c"), now, now.Add(-time.Hour))
+	if len(metrics) != 2 { //nolint:gomnd
+		t.Errorf("sent %d metrics, want the started and closed counters", len(metrics))
+	}
+	assertTotals(t, collector.state, 1, 1)
+}
+
+func TestTrackClosedNeverSeenCurrent(t *testing.T) {
+	state := newSessionsState()
+
+	newlyClosed := state.track(nil, []string{"short"}, time.Now())
+
+	if !reflect.DeepEqual(newlyClosed, []string{"short"}) {
+		t.Errorf("newly closed = %v, want [short]", newlyClosed)
+	}
+	// A session opened and closed between two updates is counted as started too
+	assertTotals(t, state, 1, 1)
+}
+
+func TestTrackSeenAgainWithinWindow(t *testing.T) {
+	state := newSessionsState()
+	now := time.Now()
+
+	state.track([]string{"a"}, nil, now)
+	state.track([]string{"a"}, nil, now.Add(time.Minute))
+	assertTotals(t, state, 1, 0)
+
+	first := state.track(nil, []string{"a"}, now.Add(2*time.Minute))
+	// The closed window overlaps the previous one so the session is returned again
+	second := state.track(nil, []string{"a"}, now.Add(3*time.Minute)) //nolint:gomnd
+	if !reflect.DeepEqual(first, []string{"a"}) || len(second) != 0 {
+		t.Errorf("newly closed = %v then %v, want [a] then none", first, second)
+	}
+	assertTotals(t, state, 1, 1)
+}
+
+func TestPrune(t *testing.T) {
+	state := newSessionsState()
+	old := time.Now()
+	recent := old.Add(time.Hour)
+
+	state.track([]string{"old-current"}, []string{"old-closed"}, old)
+	state.track([]string{"recent-current"}, []string{"recent-closed"}, recent)
+	state.prune(old.Add(time.Minute))
+
+	var started, closed []string
+	for id := range state.Started {
+		started = append(started, id)
+	}
+	for id := range state.Closed {
+		closed = append(closed, id)
+	}
+	sort.Strings(started)
+	sort.Strings(closed)
+	if !reflect.DeepEqual(started, []string{"recent-current"}) || !reflect.DeepEqual(closed, []string{"recent-closed"}) {
+		t.Errorf("after prune started = %v, closed = %v, want only recent sessions", started, closed)
+	}
+	// Totals are never decreased by pruning
+	assertTotals(t, state, 4, 2) //nolint:gomnd
+}
+
+func TestSessionsStateReload(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "sessions.json")
+	now := time.Now()
+
+	first := newSessionsCollector(config.Config{SessionsStateFile: stateFile}, log.NewNopLogger()).(*sessionsCollector)
+	if first.state != nil {
+		t.Fatal("state loaded without state file")
+	}
+	first.lastClosed = now
+	countSessions(first, sessionsWithIDs("a"), sessionsWithIDs("b"), now, now.Add(-time.Hour))
+	now = now.Add(time.Minute)
+	countSessions(first, sessionsWithIDs("a", "c"), sessionsWithIDs("b", "d"), now, now.Add(-time.Hour))
+	assertTotals(t, first.state, 2, 1)
+
+	// After a restart, sessions already counted are not counted again
+	second := newSessionsCollector(config.Config{SessionsStateFile: stateFile}, log.NewNopLogger()).(*sessionsCollector)
+	if second.state == nil {
+		t.Fatal("state not loaded from the state file")
+	}
+	assertTotals(t, second.state, 2, 1)
+	if !second.lastClosed.Equal(first.lastClosed) {
+		t.Errorf("last closed = %v, want %v", second.lastClosed, first.lastClosed)
+	}
+
+	now = now.Add(time.Minute)
+	metrics := countSessions(second, sessionsWithIDs("c", "e"), sessionsWithIDs("a", "d"), now, now.Add(-time.Hour))
+	if len(metrics) == 0 {
+		t.Error("no counters sent after reload, the state should not be a new baseline")
+	}
+	assertTotals(t, second.state, 3, 2) //nolint:gomnd
+}
+
+func TestLoadSessionsStateMissingFile(t *testing.T) {
+	state, err := loadSessionsState(filepath.Join(t.TempDir(), "missing.json"))
+	if state != nil || err != nil {
+		t.Errorf("loadSessionsState() = %v, %v, want nil state without error", state, err)
+	}
+}
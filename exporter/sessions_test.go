@@ -0,0 +1,177 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/claranet/wallix_bastion_exporter/config"
+	"github.com/claranet/wallix_bastion_exporter/wallix"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Stand-in for the sessions API filtering closed sessions on their end date like Wallix does.
+type sessionsServer struct {
+	current      []map[string]string
+	closed       []map[string]string
+	failCurrent  bool
+	lastFromDate string
+}
+
+func (s *sessionsServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	if query.Get("status") == "current" {
+		if s.failCurrent {
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+		_ = json.NewEncoder(w).Encode(s.current)
+
+		return
+	}
+
+	s.lastFromDate = query.Get("from_date")
+	from, _ := time.ParseInLocation(wallix.TimeFormat, s.lastFromDate, time.Local)
+	closed := []map[string]string{}
+	for _, session := range s.closed {
+		end, _ := time.ParseInLocation(wallix.TimeFormat, session["end"], time.Local)
+		if !end.Before(from) {
+			closed = append(closed, session)
+		}
+	}
+	_ = json.NewEncoder(w).Encode(closed)
+}
+
+func closedSession(id string, begin time.Time, end time.Time) map[string]string {
+	return map[string]string{
+		"id":              id,
+		"begin":           begin.Format(wallix.TimeFormat),
+		"end":             end.Format(wallix.TimeFormat),
+		"target_protocol": "SSH",
+	}
+}
+
+// Run an update of the collector and return the number of closed sessions in the gauge.
+func updateSessions(
+	t *testing.T, collector *sessionsCollector, server *sessionsServer,
+) (closedGauge float64, err error) {
+	t.Helper()
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	client := wallix.NewClient(httpServer.Client(), httpServer.URL)
+
+	metricsChannel := make(chan prometheus.Metric, 100)
+	err = collector.Update(context.Background(), Scrape{}, metricsChannel, client)
+	close(metricsChannel)
+
+	for metric := range metricsChannel {
+		if metric.Desc() == metricSessions {
+			closedGauge += gaugeValue(t, metric, "closed")
+		}
+	}
+
+	return closedGauge, err
+}
+
+// Value of a sessions gauge if it has the status, zero otherwise.
+func gaugeValue(t *testing.T, metric prometheus.Metric, status string) float64 {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(constCollector{metric})
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "status" && label.GetValue() == status {
+					return m.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+
+	return 0
+}
+
+type constCollector struct {
+	metric prometheus.Metric
+}
+
+func (c constCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- c.metric.Desc()
+}
+
+func (c constCollector) Collect(metrics chan<- prometheus.Metric) {
+	metrics <- c.metric
+}
+
+func newTestSessionsCollector() *sessionsCollector {
+	return newSessionsCollector(config.Config{
+		SessionsClosedWindow:     300,
+		SessionsClosedWindowMode: config.SessionsClosedWindowFixed,
+		SessionsDurationBuckets:  []int{60, 3600},
+	}, log.NewNopLogger()).(*sessionsCollector)
+}
+
+func TestSessionsCountedAfterLastClosedOutsideWindow(t *testing.T) {
+	collector := newTestSessionsCollector()
+	now := time.Now()
+	lastClosed := now.Add(-time.Hour)
+	collector.state = newSessionsState()
+	collector.state.LastClosed = lastClosed
+	collector.lastClosed = lastClosed
+
+	// Closed 30 minutes ago, outside the 5 minutes window but after the last count
+	server := &sessionsServer{
+		closed: []map[string]string{
+			closedSession("gap", now.Add(-40*time.Minute), now.Add(-30*time.Minute)),
+			closedSession("recent", now.Add(-2*time.Minute), now.Add(-time.Minute)),
+		},
+	}
+	closedGauge, err := updateSessions(t, collector, server)
+	if err != nil {
+		t.Fatalf("Update() unexpected error: %v", err)
+	}
+
+	if server.lastFromDate != lastClosed.Format(wallix.TimeFormat) {
+		t.Errorf("closed sessions requested from %s, want the last count %s",
+			server.lastFromDate, lastClosed.Format(wallix.TimeFormat))
+	}
+	if closedGauge != 1 {
+		t.Errorf("closed sessions gauge = %v, want only the session in the window", closedGauge)
+	}
+	assertTotals(t, collector.state, 2, 2) //nolint:gomnd
+	// The gap session lasted 10 minutes, the recent one 1 minute
+	histogram := collector.state.Durations["SSH"]
+	if histogram == nil || histogram.Count != 2 || histogram.Counts[0] != 1 || histogram.Counts[1] != 2 {
+		t.Errorf("duration histogram = %+v, want both sessions observed", histogram)
+	}
+	if !collector.state.LastClosed.After(lastClosed) {
+		t.Errorf("last closed not advanced after a successful count: %v", collector.state.LastClosed)
+	}
+}
+
+func TestSessionsLastClosedKeptWhenCurrentFails(t *testing.T) {
+	collector := newTestSessionsCollector()
+	lastClosed := time.Now().Add(-time.Hour)
+	collector.state = newSessionsState()
+	collector.state.LastClosed = lastClosed
+	collector.lastClosed = lastClosed
+
+	server := &sessionsServer{failCurrent: true}
+	if _, err := updateSessions(t, collector, server); err == nil {
+		t.Fatal("Update() expected an error when current sessions fail")
+	}
+
+	if !collector.lastClosed.Equal(lastClosed) || !collector.state.LastClosed.Equal(lastClosed) {
+		t.Errorf("last closed advanced to %v / %v without counting, want %v",
+			collector.lastClosed, collector.state.LastClosed, lastClosed)
+	}
+}
@@ -0,0 +1,74 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/claranet/wallix_bastion_exporter/config"
+	"github.com/claranet/wallix_bastion_exporter/wallix"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var metricTargets = prometheus.NewDesc(
+	prometheus.BuildFQName(Namespace, "", "targets"),
+	"Current number of targets.",
+	[]string{"type"}, nil,
+)
+
+// Types of targets requested concurrently.
+var targetTypes = []string{
+	"session_accounts",
+	"session_account_mappings",
+	"session_interactive_logins",
+	"session_scenario_accounts",
+	"password_retrieval_accounts",
+}
+
+type targetsCollector struct{}
+
+func init() {
+	registerCollector("targets", true, newTargetsCollector)
+}
+
+func newTargetsCollector(_ config.Config, _ log.Logger) Collector {
+	return &targetsCollector{}
+}
+
+func (c *targetsCollector) Update(
+	ctx context.Context, _ Scrape, metricsChannel chan<- prometheus.Metric, client *wallix.Client,
+) error {
+	var (
+		wg     sync.WaitGroup
+		mutex  sync.Mutex
+		errors collectorErrors
+	)
+
+	for _, targetType := range targetTypes {
+		wg.Add(1)
+		go func(targetType string) {
+			defer wg.Done()
+
+			targets, err := client.GetTargets(ctx, targetType)
+			if err != nil {
+				mutex.Lock()
+				errors = append(errors, fmt.Errorf("cannot get %s targets: %w", targetType, err))
+				mutex.Unlock()
+
+				return
+			}
+			metricsChannel <- prometheus.MustNewConstMetric(
+				metricTargets, prometheus.GaugeValue, float64(len(targets)), targetType,
+			)
+		}(targetType)
+	}
+
+	wg.Wait()
+
+	if len(errors) > 0 {
+		return errors
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/claranet/wallix_bastion_exporter/config"
+	"github.com/claranet/wallix_bastion_exporter/wallix"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var metricUsers = prometheus.NewDesc(
+	prometheus.BuildFQName(Namespace, "", "users"),
+	"Current number of users.",
+	nil, nil,
+)
+
+type usersCollector struct{}
+
+func init() {
+	registerCollector("users", true, newUsersCollector)
+}
+
+func newUsersCollector(_ config.Config, _ log.Logger) Collector {
+	return &usersCollector{}
+}
+
+func (c *usersCollector) Update(
+	ctx context.Context, _ Scrape, metricsChannel chan<- prometheus.Metric, client *wallix.Client,
+) error {
+	users, err := client.GetUsers(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot get users: %w", err)
+	}
+	metricsChannel <- prometheus.MustNewConstMetric(
+		metricUsers, prometheus.GaugeValue, float64(len(users)),
+	)
+
+	return nil
+}
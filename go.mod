@@ -3,8 +3,12 @@ module github.com/claranet/wallix_bastion_exporter
 go 1.16
 
 require (
+	github.com/go-kit/log v0.1.0
 	github.com/prometheus/client_golang v1.11.0
+	github.com/prometheus/common v0.29.0
+	github.com/prometheus/exporter-toolkit v0.7.1
 	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.8.1
 	golang.org/x/sys v0.0.0-20210831042530-f4d43177bf5e // indirect
+	gopkg.in/yaml.v2 v2.4.0
 )
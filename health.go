@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// The process is healthy as long as it serves requests.
+func healthyHandler(w http.ResponseWriter, req *http.Request) {
+	fmt.Fprintln(w, "Healthy.")
+}
+
+// Ready when the last authentication to the API succeeded, without requesting the API.
+// Without global credentials, only the probe endpoint is served so there is nothing to wait for.
+func (r *reloader) readyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		wallixExporter := r.instance().exporter
+		if wallixExporter != nil {
+			if err := wallixExporter.Ready(); err != nil {
+				http.Error(w, "Not ready: "+err.Error(), http.StatusServiceUnavailable)
+
+				return
+			}
+		}
+		fmt.Fprintln(w, "Ready.")
+	}
+}
@@ -1,10 +1,11 @@
 package httpclient
 
 import (
-	"crypto/tls"
 	"net/http"
 	"net/http/cookiejar"
 	"time"
+
+	"github.com/go-kit/log"
 )
 
 // The configuration to build the HTTP client.
@@ -12,9 +13,18 @@ type HTTPConfig struct {
 	Timeout       int
 	Username      string
 	Password      string
+	APIKey        string
 	Headers       map[string]string
 	SkipVerify    bool
 	CookieManager bool
+	// PEM files of certificate authorities to trust and of the client certificate.
+	CAFile        string
+	CertFile      string
+	KeyFile       string
+	ServerName    string
+	TLSMinVersion string
+	// Logger for events like certificates reload, nothing is logged if nil.
+	Logger log.Logger
 }
 
 // An http transport that injects basic auth into each request.
@@ -32,19 +42,46 @@ func (t *TransportWithBasicAuth) RoundTrip(req *http.Request) (*http.Response, e
 	return t.RoundTripper.RoundTrip(req)
 }
 
+func (t *TransportWithBasicAuth) CloseIdleConnections() {
+	closeIdleConnections(t.RoundTripper)
+}
+
+// An http transport that injects Wallix API key headers into each request.
+type TransportWithAPIKey struct {
+	http.RoundTripper
+	Username string
+	APIKey   string
+}
+
+func (t *TransportWithAPIKey) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.Header.Set("X-Auth-User", t.Username)
+	req.Header.Set("X-Auth-Key", t.APIKey)
+
+	return t.RoundTripper.RoundTrip(req)
+}
+
+func (t *TransportWithAPIKey) CloseIdleConnections() {
+	closeIdleConnections(t.RoundTripper)
+}
+
 // Build returns a configured http.Client.
 func (h *HTTPConfig) Build() (client *http.Client, err error) {
-	roundTripper := func() http.RoundTripper {
-		transport := http.DefaultTransport.(*http.Transport).Clone()
-
-		transport.TLSClientConfig = &tls.Config{
-			InsecureSkipVerify: h.SkipVerify, //nolint:gosec
-		}
+	tlsConfig, err := h.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
 
-		return transport
-	}()
+	var roundTripper http.RoundTripper = transport
 
-	if h.Username != "" {
+	if h.APIKey != "" {
+		roundTripper = &TransportWithAPIKey{
+			RoundTripper: roundTripper,
+			Username:     h.Username,
+			APIKey:       h.APIKey,
+		}
+	} else if h.Username != "" {
 		roundTripper = &TransportWithBasicAuth{
 			RoundTripper: roundTripper,
 			Username:     h.Username,
@@ -93,3 +130,14 @@ func (h *addHeader) RoundTrip(req *http.Request) (*http.Response, error) {
 
 	return h.rt.RoundTrip(req)
 }
+
+func (h *addHeader) CloseIdleConnections() {
+	closeIdleConnections(h.rt)
+}
+
+// Forward to the wrapped transport, http.Client only closes idle connections of a transport implementing it.
+func closeIdleConnections(roundTripper http.RoundTripper) {
+	if closer, ok := roundTripper.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
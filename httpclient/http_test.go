@@ -0,0 +1,53 @@
+package httpclient
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCloseIdleConnections(t *testing.T) {
+	tests := []struct {
+		name   string
+		config HTTPConfig
+	}{
+		{"basic auth", HTTPConfig{Timeout: 1, Username: "monitoring", Password: "secret"}},
+		{"api key", HTTPConfig{Timeout: 1, Username: "monitoring", APIKey: "key"}},
+		{"no credentials", HTTPConfig{Timeout: 1}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			closed := make(chan struct{}, 1)
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+			server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+				if state == http.StateClosed {
+					closed <- struct{}{}
+				}
+			}
+			server.Start()
+			defer server.Close()
+
+			client, err := test.config.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := client.Get(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			// The connection is kept alive until closed through the wrapping transports
+			client.CloseIdleConnections()
+			select {
+			case <-closed:
+			case <-time.After(time.Second):
+				t.Error("idle connection not closed")
+			}
+		})
+	}
+}
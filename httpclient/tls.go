@@ -0,0 +1,216 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// Accepted values for the minimum TLS version.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Parse a TLS version like "1.2", empty keeps the default of crypto/tls.
+func ParseTLSVersion(version string) (uint16, error) {
+	if version == "" {
+		return 0, nil
+	}
+	tlsVersion, ok := tlsVersions[version]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q, expected one of 1.0, 1.1, 1.2 or 1.3", version)
+	}
+
+	return tlsVersion, nil
+}
+
+// Build the TLS configuration of the transport.
+// Certificate files are loaded once to fail early, then reloaded on handshake when modified on disk.
+func (h *HTTPConfig) tlsConfig() (*tls.Config, error) {
+	minVersion, err := ParseTLSVersion(h.TLSMinVersion)
+	if err != nil {
+		return nil, err
+	}
+	logger := h.Logger
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: h.SkipVerify, //nolint:gosec
+		ServerName:         h.ServerName,
+		MinVersion:         minVersion,
+	}
+
+	if (h.CertFile == "") != (h.KeyFile == "") {
+		return nil, errors.New("both certificate and key files are required for client authentication")
+	}
+	if h.CertFile != "" {
+		certificate := &certificateReloader{certFile: h.CertFile, keyFile: h.KeyFile, logger: logger}
+		if _, err := certificate.get(); err != nil {
+			return nil, err
+		}
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return certificate.get()
+		}
+	}
+
+	// The default verification cannot use a pool reloaded after the transport is built,
+	// so the verification is done in VerifyConnection instead.
+	if h.CAFile != "" && !h.SkipVerify {
+		ca := &caReloader{caFile: h.CAFile, logger: logger}
+		if _, err := ca.get(); err != nil {
+			return nil, err
+		}
+		tlsConfig.InsecureSkipVerify = true //nolint:gosec
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			return ca.verify(state)
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// Modification times of files to know when to reload them.
+type fileVersions map[string]time.Time
+
+// Whether one of the files has changed since the versions were taken.
+func (v fileVersions) changed() (fileVersions, bool) {
+	current := fileVersions{}
+	changed := false
+	for file, modTime := range v {
+		info, err := os.Stat(file)
+		if err != nil {
+			// Keep the loaded version, the error is reported on reload
+			return v, true
+		}
+		current[file] = info.ModTime()
+		if !info.ModTime().Equal(modTime) {
+			changed = true
+		}
+	}
+
+	return current, changed
+}
+
+// Client certificate reloaded when its files are modified.
+type certificateReloader struct {
+	certFile    string
+	keyFile     string
+	certificate *tls.Certificate
+	versions    fileVersions
+	mutex       sync.Mutex
+	logger      log.Logger
+}
+
+// Return the certificate, reloaded if needed.
+// The last loaded certificate is kept if the reload fails, like while files are being replaced.
+func (r *certificateReloader) get() (*tls.Certificate, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.certificate != nil {
+		if _, changed := r.versions.changed(); !changed {
+			return r.certificate, nil
+		}
+	}
+
+	versions, _ := fileVersions{r.certFile: time.Time{}, r.keyFile: time.Time{}}.changed()
+	certificate, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		err = fmt.Errorf("cannot load client certificate %s: %w", r.certFile, err)
+		if r.certificate == nil {
+			return nil, err
+		}
+		level.Warn(r.logger).Log("msg", "keep previous client certificate", "err", err)
+
+		return r.certificate, nil
+	}
+	r.certificate = &certificate
+	r.versions = versions
+
+	return r.certificate, nil
+}
+
+// Pool of certificate authorities reloaded when its file is modified.
+type caReloader struct {
+	caFile   string
+	pool     *x509.CertPool
+	versions fileVersions
+	mutex    sync.Mutex
+	logger   log.Logger
+}
+
+// Return the pool, reloaded if needed.
+// The last loaded pool is kept if the reload fails.
+func (r *caReloader) get() (*x509.CertPool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.pool != nil {
+		if _, changed := r.versions.changed(); !changed {
+			return r.pool, nil
+		}
+	}
+
+	versions, _ := fileVersions{r.caFile: time.Time{}}.changed()
+	pool, err := loadCertPool(r.caFile)
+	if err != nil {
+		if r.pool == nil {
+			return nil, err
+		}
+		level.Warn(r.logger).Log("msg", "keep previous CA certificates", "err", err)
+
+		return r.pool, nil
+	}
+	r.pool = pool
+	r.versions = versions
+
+	return r.pool, nil
+}
+
+// Verify the server certificate chain and name like crypto/tls does by default.
+func (r *caReloader) verify(state tls.ConnectionState) error {
+	pool, err := r.get()
+	if err != nil {
+		return err
+	}
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("no server certificate")
+	}
+
+	options := x509.VerifyOptions{
+		Roots:         pool,
+		DNSName:       state.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, certificate := range state.PeerCertificates[1:] {
+		options.Intermediates.AddCert(certificate)
+	}
+	_, err = state.PeerCertificates[0].Verify(options)
+
+	return err
+}
+
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	content, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(content) {
+		return nil, fmt.Errorf("no valid certificate found in CA file %s", caFile)
+	}
+
+	return pool, nil
+}
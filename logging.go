@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/promlog"
+)
+
+// Same timestamp as promlog with milliseconds.
+var timestampFormat = log.TimestampFormat(
+	func() time.Time { return time.Now().UTC() },
+	"2006-01-02T15:04:05.000Z07:00",
+)
+
+// Filter of log messages by level which can be changed on reload.
+// It is wrapped by the timestamp and caller context so the caller stays accurate.
+type levelFilter struct {
+	base    log.Logger
+	mutex   sync.RWMutex
+	leveled log.Logger
+}
+
+func (f *levelFilter) Log(keyvals ...interface{}) error {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	return f.leveled.Log(keyvals...)
+}
+
+// Change the minimum level of messages logged, unknown levels are ignored.
+func (f *levelFilter) SetLevel(allowedLevel *promlog.AllowedLevel) {
+	options := map[string]level.Option{
+		"debug": level.AllowDebug(),
+		"info":  level.AllowInfo(),
+		"warn":  level.AllowWarn(),
+		"error": level.AllowError(),
+	}
+	option, ok := options[allowedLevel.String()]
+	if !ok {
+		return
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.leveled = level.NewFilter(f.base, option)
+}
+
+// Build the logger like promlog does, with a level which can be changed later with the filter.
+func newLogger(logging *promlog.Config) (log.Logger, *levelFilter) {
+	var base log.Logger
+	if logging.Format.String() == "json" {
+		base = log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+	} else {
+		base = log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
+	}
+	filter := &levelFilter{base: base, leveled: base}
+	filter.SetLevel(logging.Level)
+
+	return log.With(filter, "ts", timestampFormat, "caller", log.DefaultCaller), filter
+}
@@ -1,30 +1,120 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
 	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
 
 	"github.com/claranet/wallix_bastion_exporter/config"
 	"github.com/claranet/wallix_bastion_exporter/exporter"
 
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/common/version"
+	"github.com/prometheus/exporter-toolkit/web"
 )
 
+// Maximum time to finish ongoing scrapes and logout on shutdown.
+const shutdownTimeout = 10 * time.Second
+
+// Endpoints served besides the telemetry path by their paths, which cannot be used as telemetry path.
+func endpoints() map[string]func(r *reloader, telemetryPath string) http.HandlerFunc {
+	return map[string]func(r *reloader, telemetryPath string) http.HandlerFunc{
+		"/probe": func(r *reloader, _ string) http.HandlerFunc {
+			return func(w http.ResponseWriter, req *http.Request) {
+				r.instance().probeHandler.ServeHTTP(w, req)
+			}
+		},
+		"/-/reload": func(r *reloader, _ string) http.HandlerFunc {
+			return r.handler()
+		},
+		"/-/healthy": func(_ *reloader, _ string) http.HandlerFunc {
+			return healthyHandler
+		},
+		"/-/ready": func(r *reloader, _ string) http.HandlerFunc {
+			return r.readyHandler()
+		},
+		"/": func(_ *reloader, telemetryPath string) http.HandlerFunc {
+			return func(w http.ResponseWriter, req *http.Request) {
+				// Allows to redirect from root to metric path
+				http.Redirect(w, req, telemetryPath, http.StatusPermanentRedirect)
+			}
+		},
+	}
+}
+
+// Paths of the endpoints, reserved to them.
+func reservedPaths() []string {
+	paths := []string{}
+	for path := range endpoints() {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
 func main() {
-	cfg, err := config.LoadConfig(".")
+	collectors := exporter.Collectors()
+	cfg, err := config.LoadConfig(collectors, reservedPaths())
+	logger, logFilter := newLogger(cfg.Logging())
 	if err != nil {
-		log.Fatal("cannot load config:", err)
+		level.Error(logger).Log("msg", "cannot load config", "err", err)
+		os.Exit(1)
 	}
 
-	wallixExporter := exporter.NewExporter(cfg)
-	prometheus.MustRegister(wallixExporter)
-	log.Printf("Started %s exporter listening on %s%s\n", exporter.Namespace, cfg.ListenAddress, cfg.TelemetryPath)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Handlers are resolved at each request to serve the last loaded configuration
+	reloader, err := newReloader(ctx, cfg, collectors, logger, logFilter)
+	if err != nil {
+		level.Error(logger).Log("msg", "cannot start exporter", "err", err)
+		os.Exit(1)
+	}
+	level.Info(logger).Log(
+		"msg", "Started "+exporter.Namespace+" exporter",
+		"version", version.Info(), "build_context", version.BuildContext(),
+		"listen_address", cfg.ListenAddress, "telemetry_path", cfg.TelemetryPath,
+	)
 
-	http.Handle(cfg.TelemetryPath, promhttp.Handler())
-	http.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
-		// Allows to redirect from root to metric path
-		http.Redirect(w, req, cfg.TelemetryPath, http.StatusPermanentRedirect)
+	http.HandleFunc(cfg.TelemetryPath, func(w http.ResponseWriter, req *http.Request) {
+		reloader.instance().metricsHandler.ServeHTTP(w, req)
 	})
-	log.Fatal(http.ListenAndServe(cfg.ListenAddress, nil))
+	for path, endpoint := range endpoints() {
+		http.HandleFunc(path, endpoint(reloader, cfg.TelemetryPath))
+	}
+
+	// Reload the configuration on SIGHUP like the /-/reload endpoint
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			_ = reloader.reload()
+		}
+	}()
+
+	server := &http.Server{Addr: cfg.ListenAddress}
+	go func() {
+		// TLS and basic authentication are enabled by the web config file, if any
+		if err := web.ListenAndServe(server, cfg.WebConfigFile, logger); !errors.Is(err, http.ErrServerClosed) {
+			level.Error(logger).Log("msg", "cannot serve http", "err", err)
+			os.Exit(1)
+		}
+	}()
+
+	<-ctx.Done()
+	level.Info(logger).Log("msg", "Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		level.Warn(logger).Log("msg", "cannot shutdown http server gracefully", "err", err)
+	}
+	reloader.instance().close(shutdownCtx, logger)
 }
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/claranet/wallix_bastion_exporter/config"
+	"github.com/claranet/wallix_bastion_exporter/exporter"
+	"github.com/claranet/wallix_bastion_exporter/wallix"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	metricConfigLastReloadSuccessful = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: exporter.Namespace,
+		Name:      "config_last_reload_successful",
+		Help:      "Whether the last configuration reload attempt was successful.",
+	})
+	metricConfigLastReloadSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: exporter.Namespace,
+		Name:      "config_last_reload_success_timestamp_seconds",
+		Help:      "Timestamp of the last successful configuration reload.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(metricConfigLastReloadSuccessful, metricConfigLastReloadSuccess)
+}
+
+// Everything built from one configuration, replaced as a whole on reload.
+type instance struct {
+	config config.Config
+	// Nil without global username and secret, only the probe endpoint is then usable.
+	exporter       *exporter.Exporter
+	metricsHandler http.Handler
+	probeHandler   http.Handler
+	// Stops the background refresh and the initial authentication.
+	cancel context.CancelFunc
+}
+
+// Holds the current instance and swaps it atomically when the configuration is reloaded.
+type reloader struct {
+	logger    log.Logger
+	logFilter *levelFilter
+	// Lifetime of the background refresh of all instances.
+	ctx        context.Context //nolint:containedctx
+	collectors map[string]bool
+	current    atomic.Value
+	// Reloads are done one at a time.
+	mutex sync.Mutex
+}
+
+func newReloader(
+	ctx context.Context, cfg config.Config, collectors map[string]bool, logger log.Logger, logFilter *levelFilter,
+) (*reloader, error) {
+	r := &reloader{ctx: ctx, collectors: collectors, logger: logger, logFilter: logFilter}
+	current, err := r.newInstance(cfg)
+	if err != nil {
+		return nil, err
+	}
+	r.current.Store(current)
+	metricConfigLastReloadSuccessful.Set(1)
+	metricConfigLastReloadSuccess.SetToCurrentTime()
+
+	return r, nil
+}
+
+func (r *reloader) instance() *instance {
+	return r.current.Load().(*instance) //nolint:forcetypeassert
+}
+
+func (r *reloader) newInstance(cfg config.Config) (*instance, error) {
+	newInstance := &instance{
+		config:         cfg,
+		metricsHandler: promhttp.Handler(),
+		probeHandler:   exporter.ProbeHandler(cfg, r.logger),
+		cancel:         func() {},
+	}
+	// A global username may only be defined to be inherited by modules with their own secrets
+	if cfg.HasCredentials() {
+		wallixExporter, err := exporter.NewExporter(cfg, r.logger)
+		if err != nil {
+			return nil, err
+		}
+		var ctx context.Context
+		ctx, newInstance.cancel = context.WithCancel(r.ctx)
+		if cfg.RefreshInterval > 0 {
+			wallixExporter.StartRefresh(ctx, time.Duration(cfg.RefreshInterval)*time.Second)
+		}
+		// Authenticate right away so readiness is known before the first scrape
+		go func() {
+			if err := wallixExporter.Login(ctx); err != nil {
+				// Failures are expected when the instance is already replaced
+				if ctx.Err() == nil {
+					level.Warn(r.logger).Log("msg", "initial authentication failed", "err", err)
+				}
+			} else if cfg.APIVersion == wallix.APIVersionAuto {
+				level.Info(r.logger).Log("msg", "API version detected", "api_version", wallixExporter.APIVersion())
+			}
+		}()
+		newInstance.exporter = wallixExporter
+		newInstance.metricsHandler = exporter.MetricsHandler(wallixExporter)
+	}
+
+	return newInstance, nil
+}
+
+// Load the configuration again and replace the current instance.
+// On failure, the current instance is kept untouched.
+func (r *reloader) reload() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	err := r.swap()
+	if err != nil {
+		level.Error(r.logger).Log("msg", "cannot reload config", "err", err)
+		metricConfigLastReloadSuccessful.Set(0)
+
+		return err
+	}
+	level.Info(r.logger).Log("msg", "configuration reloaded")
+	metricConfigLastReloadSuccessful.Set(1)
+	metricConfigLastReloadSuccess.SetToCurrentTime()
+
+	return nil
+}
+
+func (r *reloader) swap() error {
+	cfg, err := config.ReloadConfig(r.collectors, reservedPaths())
+	if err != nil {
+		return err
+	}
+	newInstance, err := r.newInstance(cfg)
+	if err != nil {
+		return err
+	}
+	r.logFilter.SetLevel(cfg.Logging().Level)
+
+	previous := r.instance()
+	if cfg.ListenAddress != previous.config.ListenAddress || cfg.WebConfigFile != previous.config.WebConfigFile ||
+		cfg.TelemetryPath != previous.config.TelemetryPath {
+		level.Warn(r.logger).Log(
+			"msg", "listen-address, web.config.file and telemetry-path changes are only applied on restart",
+		)
+	}
+	r.current.Store(newInstance)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	previous.close(ctx, r.logger)
+
+	return nil
+}
+
+// Stop the background refresh and close the session to the API, if any.
+// Scrapes still running on the instance cannot authenticate again afterwards.
+func (i *instance) close(ctx context.Context, logger log.Logger) {
+	i.cancel()
+	if i.exporter != nil {
+		if err := i.exporter.Close(ctx); err != nil {
+			level.Warn(logger).Log("msg", "cannot close session", "err", err)
+		}
+	}
+}
+
+// Reload the configuration on request, only with POST or PUT methods like Prometheus.
+func (r *reloader) handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost && req.Method != http.MethodPut {
+			w.Header().Set("Allow", "POST, PUT")
+			http.Error(w, "only POST or PUT requests allowed", http.StatusMethodNotAllowed)
+
+			return
+		}
+		if err := r.reload(); err != nil {
+			http.Error(w, fmt.Sprintf("cannot reload config: %v", err), http.StatusInternalServerError)
+		}
+	}
+}
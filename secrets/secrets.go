@@ -0,0 +1,33 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// A Provider returns the current value of a secret.
+// It is called each time the secret is needed so rotations are picked up.
+type Provider interface {
+	Secret(ctx context.Context) (string, error)
+}
+
+// A secret defined directly in the configuration.
+type Static string
+
+func (s Static) Secret(ctx context.Context) (string, error) {
+	return string(s), nil
+}
+
+// A secret read from a file, trailing new lines are ignored.
+type File string
+
+func (f File) Secret(ctx context.Context) (string, error) {
+	content, err := ioutil.ReadFile(string(f))
+	if err != nil {
+		return "", fmt.Errorf("cannot read secret file: %w", err)
+	}
+
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
@@ -0,0 +1,77 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// A secret stored in a HashiCorp Vault KV secrets engine, version 1 or 2.
+type Vault struct {
+	HTTPClient *http.Client
+	// Address of Vault like http://127.0.0.1:8200
+	Address string
+	Token   string
+	// Path of the secret in the API, like "secret/data/wallix" for a KV version 2 mounted on "secret".
+	Path string
+	// Key of the secret value in the secret data.
+	Field string
+}
+
+type vaultResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []string        `json:"errors"`
+}
+
+func (v *Vault) Secret(ctx context.Context) (string, error) {
+	url := strings.TrimSuffix(v.Address, "/") + "/v1/" + strings.TrimPrefix(v.Path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot create request to Vault %s: %w", url, err)
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+
+	res, err := v.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("cannot do request to Vault %s: %w", url, err)
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+
+	response := vaultResponse{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", fmt.Errorf("cannot decode Vault response of %s, http status %d: %w", v.Path, res.StatusCode, err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault response http status not ok: %d, errors: %v", res.StatusCode, response.Errors)
+	}
+
+	return v.field(response.Data)
+}
+
+// Extract the field from secret data, nested in another "data" object for KV version 2.
+func (v *Vault) field(data json.RawMessage) (string, error) {
+	values := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return "", fmt.Errorf("cannot decode Vault secret %s: %w", v.Path, err)
+	}
+	if nested, ok := values["data"]; ok && strings.HasPrefix(strings.TrimSpace(string(nested)), "{") {
+		if _, isV2 := values["metadata"]; isV2 {
+			return v.field(nested)
+		}
+	}
+
+	raw, ok := values[v.Field]
+	if !ok {
+		return "", fmt.Errorf("no field %q in Vault secret %s", v.Field, v.Path)
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", fmt.Errorf("field %q of Vault secret %s is not a string: %w", v.Field, v.Path, err)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,159 @@
+package secrets
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Stand-in for Vault returning the body with the status for the expected path and token only.
+func newVaultServer(t *testing.T, path string, status int, body string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/"+path {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+
+			return
+		}
+		if req.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+
+			return
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestVaultSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		status  int
+		body    string
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "kv v1",
+			path:   "kv/wallix",
+			status: http.StatusOK,
+			body:   `{"data":{"password":"v1-secret"},"lease_duration":2764800}`,
+			want:   "v1-secret",
+		},
+		{
+			name:   "kv v2",
+			path:   "secret/data/wallix",
+			status: http.StatusOK,
+			body:   `{"data":{"data":{"password":"v2-secret"},"metadata":{"version":3}}}`,
+			want:   "v2-secret",
+		},
+		{
+			name:   "kv v1 with a field named data",
+			path:   "kv/wallix",
+			status: http.StatusOK,
+			body:   `{"data":{"data":{"other":"value"},"password":"v1-secret"}}`,
+			want:   "v1-secret",
+		},
+		{
+			name:    "missing field",
+			path:    "secret/data/wallix",
+			status:  http.StatusOK,
+			body:    `{"data":{"data":{"username":"monitoring"},"metadata":{"version":1}}}`,
+			wantErr: `no field "password"`,
+		},
+		{
+			name:    "field not a string",
+			path:    "kv/wallix",
+			status:  http.StatusOK,
+			body:    `{"data":{"password":42}}`,
+			wantErr: "is not a string",
+		},
+		{
+			name:    "status not ok",
+			path:    "secret/data/wallix",
+			status:  http.StatusInternalServerError,
+			body:    `{"errors":["internal error"]}`,
+			wantErr: "http status not ok: 500",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			server := newVaultServer(t, test.path, test.status, test.body)
+			vault := &Vault{
+				HTTPClient: server.Client(),
+				Address:    server.URL + "/",
+				Token:      "token",
+				Path:       "/" + test.path,
+				Field:      "password",
+			}
+
+			got, err := vault.Secret(context.Background())
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("Secret() error = %v, want error containing %q", err, test.wantErr)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("Secret() unexpected error: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("Secret() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestVaultSecretForbidden(t *testing.T) {
+	server := newVaultServer(t, "kv/wallix", http.StatusOK, `{"data":{"password":"secret"}}`)
+	vault := &Vault{
+		HTTPClient: server.Client(),
+		Address:    server.URL,
+		Token:      "wrong",
+		Path:       "kv/wallix",
+		Field:      "password",
+	}
+
+	if _, err := vault.Secret(context.Background()); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("Secret() error = %v, want http status 403", err)
+	}
+}
+
+func TestFileSecretReread(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	file := File(path)
+
+	for _, content := range []string{"first\n", "second\r\n", "third"} {
+		if err := ioutil.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		got, err := file.Secret(context.Background())
+		if err != nil {
+			t.Fatalf("Secret() unexpected error: %v", err)
+		}
+		if want := strings.TrimRight(content, "\r\n"); got != want {
+			t.Errorf("Secret() = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestFileSecretMissing(t *testing.T) {
+	file := File(filepath.Join(t.TempDir(), "missing"))
+
+	if _, err := file.Secret(context.Background()); err == nil {
+		t.Fatal("Secret() expected an error for a missing file")
+	}
+}
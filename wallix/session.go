@@ -0,0 +1,162 @@
+package wallix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Authenticate with the client credentials if there is no session yet.
+// The session cookie is then reused by subsequent requests.
+func (c *Client) Login(ctx context.Context) error {
+	c.sessionMutex.Lock()
+	defer c.sessionMutex.Unlock()
+
+	if c.session != 0 {
+		return nil
+	}
+
+	return c.login(ctx)
+}
+
+// Close the session on the API, if any, and prevent any further authentication with the client.
+func (c *Client) Logout(ctx context.Context) error {
+	c.sessionMutex.Lock()
+	defer c.sessionMutex.Unlock()
+
+	c.closed = true
+	// There is no session to close with an API key
+	if c.session == 0 || c.UseAPIKey {
+		return nil
+	}
+	c.session = 0
+
+	if _, err := c.doRequest(ctx, http.MethodGet, "/logout", nil, nil); err != nil {
+		return fmt.Errorf("cannot logout: %w", err)
+	}
+
+	return nil
+}
+
+// Make sure the API answers with a valid session, authenticating first if there is none.
+// Unlike Login, a request is always done so an unreachable API is detected with a cached session.
+func (c *Client) Ping(ctx context.Context) error {
+	if err := c.Login(ctx); err != nil {
+		return err
+	}
+	session := c.currentSession()
+	var version Version
+	err := c.Query(ctx, "/version", nil, &version)
+
+	// Only this lightweight request tells the API is unreachable, a slow resource requested by a collector
+	// may time out while the session is still valid. A request abandoned by the caller tells nothing.
+	var requestError *RequestError
+	if errors.As(err, &requestError) && requestError.StatusCode == 0 && ctx.Err() == nil {
+		c.forgetSession(session, err)
+	}
+
+	return err
+}
+
+// Forget the session when a request made with it is rejected.
+func (c *Client) requestFailed(session uint64, err error) {
+	var statusError *StatusError
+	if errors.As(err, &statusError) && statusError.StatusCode == http.StatusUnauthorized {
+		c.forgetSession(session, err)
+	}
+}
+
+// Record the failure so it is reported by LastAuthentication and the next login authenticates again.
+func (c *Client) forgetSession(session uint64, err error) {
+	c.sessionMutex.Lock()
+	defer c.sessionMutex.Unlock()
+
+	if c.session == session {
+		c.session = 0
+	}
+	c.lastAuthentication = time.Now()
+	c.lastAuthenticationError = err
+}
+
+// Time and error of the last authentication, without requesting the API.
+// The time is zero if no authentication was done yet.
+func (c *Client) LastAuthentication() (time.Time, error) {
+	c.sessionMutex.Lock()
+	defer c.sessionMutex.Unlock()
+
+	return c.lastAuthentication, c.lastAuthenticationError
+}
+
+func (c *Client) currentSession() uint64 {
+	c.sessionMutex.Lock()
+	defer c.sessionMutex.Unlock()
+
+	return c.session
+}
+
+// Authenticate again after a request was rejected with the given session.
+// Concurrent requests rejected with the same session authenticate only once.
+func (c *Client) renewSession(ctx context.Context, rejected uint64) error {
+	c.sessionMutex.Lock()
+	defer c.sessionMutex.Unlock()
+
+	if c.session != rejected && c.session != 0 {
+		return nil
+	}
+
+	return c.login(ctx)
+}
+
+// Must be called with the session mutex locked.
+// In auto mode, the API version is then detected with the session on the first login.
+// With an API key, it only checks the key is accepted on a lightweight resource.
+func (c *Client) login(ctx context.Context) error {
+	if c.closed {
+		return errors.New("client closed by logout")
+	}
+	err := c.authenticate(ctx)
+	if err == nil {
+		if err = c.resolveAPIVersion(ctx); err != nil && !c.UseAPIKey {
+			// The session is not kept, so close it right away
+			_, _ = c.doRequest(ctx, http.MethodGet, "/logout", nil, nil)
+		}
+	}
+	c.lastAuthentication = time.Now()
+	c.lastAuthenticationError = err
+	if err != nil {
+		c.session = 0
+		if c.Observer != nil {
+			c.Observer.ObserveAuthenticationFailure(err)
+		}
+
+		return err
+	}
+	c.sessionCount++
+	c.session = c.sessionCount
+
+	return nil
+}
+
+func (c *Client) authenticate(ctx context.Context) error {
+	if c.UseAPIKey {
+		_, err := c.doRequest(ctx, http.MethodGet, "/version", nil, nil)
+
+		return err
+	}
+
+	return c.authenticateWithPassword(ctx)
+}
+
+func (c *Client) authenticateWithPassword(ctx context.Context) error {
+	if c.Password == nil {
+		return fmt.Errorf("no password to authenticate")
+	}
+	password, err := c.Password.Secret(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot get password: %w", err)
+	}
+
+	return c.Authenticate(ctx, c.Username, password)
+}
@@ -0,0 +1,169 @@
+package wallix
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// A user from /users API.
+type User struct {
+	UserName string `json:"user_name"`
+}
+
+// A user group from /usergroups API.
+type Group struct {
+	ID string `json:"id"`
+}
+
+// A device from /devices API.
+type Device struct {
+	ID string `json:"id"`
+}
+
+// A target from /targets API.
+type Target struct {
+	ID string `json:"id"`
+}
+
+// A session from /sessions API.
+type Session struct {
+	ID             string `json:"id"`
+	Begin          Time   `json:"begin"`
+	End            Time   `json:"end"`
+	TargetProtocol string `json:"target_protocol"`
+	TargetDevice   string `json:"target_device"`
+	TargetAccount  string `json:"target_account"`
+	User           string `json:"user"`
+	UserGroup      string `json:"user_group"`
+}
+
+// Encryption information from /encryption API.
+type Encryption struct {
+	Encryption    string `json:"encryption"`
+	SecurityLevel string `json:"security_level"`
+}
+
+// License information from /licenseinfo API.
+// Fields not always returned by the API are pointers to know if they are set.
+type License struct {
+	IsExpired    *bool    `json:"is_expired"`
+	IsValid      *bool    `json:"is_valid"`
+	Primary      float64  `json:"primary"`
+	PrimaryMax   *float64 `json:"primary_max"`
+	Secondary    float64  `json:"secondary"`
+	SecondaryMax *float64 `json:"secondary_max"`
+	NamedUser    float64  `json:"named_user"`
+	NamedUserMax *float64 `json:"named_user_max"`
+	Resource     float64  `json:"resource"`
+	ResourceMax  *float64 `json:"resource_max"`
+	Waapm        float64  `json:"waapm"`
+	WaapmMax     *float64 `json:"waapm_max"`
+	PmTarget     float64  `json:"pm_target"`
+	PmTargetMax  *float64 `json:"pm_target_max"`
+	SmTarget     float64  `json:"sm_target"`
+	SmTargetMax  *float64 `json:"sm_target_max"`
+	// Optional metadata kept raw so an unexpected format does not prevent decoding the usage,
+	// they are decoded by Expiration and Metadata.
+	// Depending on the version, the expiration date is returned under one of these names.
+	ExpirationDate json.RawMessage `json:"expiration_date"`
+	ExpiryDate     json.RawMessage `json:"expiry_date"`
+	Type           json.RawMessage `json:"type"`
+	Customer       json.RawMessage `json:"customer"`
+	Features       json.RawMessage `json:"features"`
+}
+
+// Descriptive information of a license.
+type LicenseMetadata struct {
+	Type     string
+	Customer string
+	Features []string
+}
+
+// Expiration date of the license, zero if the API does not return one like for a license without expiration.
+// The date is either a DateFormat or a TimeFormat.
+func (l License) Expiration() (time.Time, error) {
+	raw := l.ExpirationDate
+	if isEmptyJSON(raw) {
+		raw = l.ExpiryDate
+	}
+	if isEmptyJSON(raw) {
+		return time.Time{}, nil
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return time.Time{}, fmt.Errorf("cannot decode license expiration date %s: %w", raw, err)
+	}
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{DateFormat, TimeFormat} {
+		if expiration, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return expiration, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("cannot decode license expiration date %q", value)
+}
+
+// Type, customer and features of the license, empty if not returned by the API.
+func (l License) Metadata() (metadata LicenseMetadata, err error) {
+	fields := []struct {
+		name  string
+		raw   json.RawMessage
+		value interface{}
+	}{
+		{"type", l.Type, &metadata.Type},
+		{"customer", l.Customer, &metadata.Customer},
+		{"features", l.Features, &metadata.Features},
+	}
+	for _, field := range fields {
+		if isEmptyJSON(field.raw) {
+			continue
+		}
+		if err := json.Unmarshal(field.raw, field.value); err != nil {
+			return LicenseMetadata{}, fmt.Errorf("cannot decode license %s %s: %w", field.name, field.raw, err)
+		}
+	}
+
+	return metadata, nil
+}
+
+// Whether a raw field is missing or null.
+func isEmptyJSON(raw json.RawMessage) bool {
+	return len(raw) == 0 || string(raw) == "null"
+}
+
+// Version information from /version API.
+type Version struct {
+	// Version of the API.
+	Version string `json:"version"`
+	// Version of the bastion, the complete one contains the build number.
+	WabVersion         string `json:"wab_version"`
+	WabCompleteVersion string `json:"wab_complete_version"`
+}
+
+// A date in the TimeFormat of the API, zero if empty or null.
+type Time struct {
+	time.Time
+}
+
+func (t *Time) UnmarshalJSON(data []byte) error {
+	var value *string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("cannot decode date: %w", err)
+	}
+	if value == nil || *value == "" {
+		t.Time = time.Time{}
+
+		return nil
+	}
+
+	parsed, err := time.ParseInLocation(TimeFormat, *value, time.Local)
+	if err != nil {
+		return fmt.Errorf("cannot decode date: %w", err)
+	}
+	t.Time = parsed
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package wallix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// URL of the API with the version, requested by default if empty or not detected yet.
+func (c *Client) versionedURL() string {
+	version := c.APIVersion
+	if version == APIVersionAuto {
+		c.versionMutex.RLock()
+		version = c.detectedVersion
+		c.versionMutex.RUnlock()
+	}
+	if version == "" {
+		return c.URL
+	}
+
+	return c.URL + "/v" + version
+}
+
+// Version of the API requested, empty for the default version of the bastion.
+func (c *Client) CurrentAPIVersion() string {
+	if c.APIVersion != APIVersionAuto {
+		return c.APIVersion
+	}
+	c.versionMutex.RLock()
+	defer c.versionMutex.RUnlock()
+
+	return c.detectedVersion
+}
+
+// Detect the API version in auto mode if not done yet, so it is kept across sessions.
+// It must be called once authenticated on the default version.
+func (c *Client) resolveAPIVersion(ctx context.Context) error {
+	if c.APIVersion != APIVersionAuto || c.CurrentAPIVersion() != "" {
+		return nil
+	}
+	version, err := c.DetectAPIVersion(ctx)
+	if err != nil {
+		return err
+	}
+	c.versionMutex.Lock()
+	defer c.versionMutex.Unlock()
+
+	c.detectedVersion = version
+
+	return nil
+}
+
+// Find the highest known version supported by the bastion by requesting /version of each one.
+// The client must be authenticated so a version is supported only when the resource is returned,
+// a version not found is skipped and any other error stops the detection.
+func (c *Client) DetectAPIVersion(ctx context.Context) (string, error) {
+	for _, version := range KnownAPIVersions {
+		probe := &Client{
+			HTTPClient: c.HTTPClient,
+			URL:        c.URL,
+			APIVersion: version,
+			Observer:   c.Observer,
+		}
+		_, err := probe.doRequest(ctx, http.MethodGet, "/version", nil, nil)
+		var statusError *StatusError
+		switch {
+		case err == nil:
+			return version, nil
+		case errors.As(err, &statusError) && statusError.StatusCode == http.StatusNotFound:
+			continue
+		default:
+			return "", fmt.Errorf("cannot detect API version: %w", err)
+		}
+	}
+
+	return "", fmt.Errorf("no API version supported among %s", strings.Join(KnownAPIVersions, ", "))
+}
@@ -4,17 +4,30 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sync"
 	"time"
+
+	"github.com/claranet/wallix_bastion_exporter/secrets"
 )
 
 const (
 	// Format expected by Wallix API on some resources like "sessions".
 	TimeFormat = "2006-01-02 15:04:05"
+	// Format of dates without time like the license expiration.
+	DateFormat = "2006-01-02"
+	// Fields requested on "sessions" resource.
+	sessionsFields = "id,begin,end,target_protocol,target_device,target_account,user,user_group"
+	// Detect the API version instead of using a fixed one.
+	APIVersionAuto = "auto"
 )
 
+// Versions of the API the exporter knows how to parse, from the highest.
+var KnownAPIVersions = []string{"3.12", "3.8", "3.6", "3.3", "3.0", "2.1"}
+
 // To pass credentials information to first request which login to API.
 type BasicAuth struct {
 	Username string
@@ -26,13 +39,124 @@ type APIError struct {
 	Description string `json:"description"`
 }
 
-// Wraps any requests to Wallix bastion API.
-func doRequest(
-	client *http.Client, method string, url string, params map[string]string, basicAuth *BasicAuth,
+// Returned when the API responds with an unexpected http status.
+type StatusError struct {
+	StatusCode int
+	// Error details if the response is a json API error, nil otherwise.
+	APIError *APIError
+	Body     string
+}
+
+func (e *StatusError) Error() string {
+	if e.APIError != nil {
+		return fmt.Sprintf("response http status not ok: %d, api error response: %v", e.StatusCode, *e.APIError)
+	}
+
+	return fmt.Sprintf("response http status not ok: %d, plain text response: %s", e.StatusCode, e.Body)
+}
+
+// Returned when a request to the API fails, with details about the request.
+type RequestError struct {
+	// Path of the resource relative to the API URL, "/" for authentication.
+	Endpoint string
+	// Zero if no response was received.
+	StatusCode int
+	Duration   time.Duration
+	Err        error
+}
+
+func (e *RequestError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// Notified of requests done by the client, like to instrument it.
+type Observer interface {
+	// Called after each request, the status code is zero if no response was received.
+	ObserveRequest(endpoint string, statusCode int, duration time.Duration)
+	// Called when an authentication is rejected or cannot be done.
+	ObserveAuthenticationFailure(err error)
+}
+
+// Client to request Wallix bastion API.
+// With credentials, it keeps the session cookie of the first authentication
+// and authenticates again only when the session is rejected by the API.
+type Client struct {
+	HTTPClient *http.Client
+	// Base URL of the API like https://127.0.0.1/api
+	URL string
+	// Version of the API to request like 3.6, empty for the default version of the bastion.
+	// With APIVersionAuto, it is detected on the first authentication.
+	APIVersion string
+	Username   string
+	// Read at each authentication so a rotated password is used.
+	Password secrets.Provider
+	// Whether the HTTP client authenticates each request with an API key,
+	// no login is then required.
+	UseAPIKey bool
+	// Optional observer of the requests.
+	Observer Observer
+
+	sessionMutex sync.Mutex
+	// Identifier of the current session, zero without session.
+	session      uint64
+	sessionCount uint64
+	// Set by Logout so no session is opened anymore, like by a request still running.
+	closed bool
+	// Result of the last authentication, zero time before the first one.
+	// A request rejected or without response afterwards is recorded as a failure too.
+	lastAuthentication      time.Time
+	lastAuthenticationError error
+
+	versionMutex sync.RWMutex
+	// Version detected in auto mode, empty until then.
+	detectedVersion string
+}
+
+func NewClient(httpClient *http.Client, url string) *Client {
+	return &Client{
+		HTTPClient: httpClient,
+		URL:        url,
+	}
+}
+
+// Wraps any requests to Wallix bastion API, errors are returned as *RequestError.
+func (c *Client) doRequest(
+	ctx context.Context, method string, path string, params map[string]string, basicAuth *BasicAuth,
 ) (body []byte, err error) {
-	req, err := http.NewRequestWithContext(context.Background(), method, url, nil)
+	endpoint := path
+	if endpoint == "" {
+		endpoint = "/"
+	}
+
+	begin := time.Now()
+	body, statusCode, err := c.send(ctx, method, path, params, basicAuth)
+	duration := time.Since(begin)
+	if c.Observer != nil {
+		c.Observer.ObserveRequest(endpoint, statusCode, duration)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("cannot create request to Wallix bastion %s: %w", url, err)
+		return body, &RequestError{
+			Endpoint:   endpoint,
+			StatusCode: statusCode,
+			Duration:   duration,
+			Err:        err,
+		}
+	}
+
+	return body, nil
+}
+
+func (c *Client) send(
+	ctx context.Context, method string, path string, params map[string]string, basicAuth *BasicAuth,
+) (body []byte, statusCode int, err error) {
+	url := c.versionedURL() + path
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot create request to Wallix bastion %s: %w", url, err)
 	}
 
 	if params != nil {
@@ -47,9 +171,9 @@ func doRequest(
 		req.SetBasicAuth(basicAuth.Username, basicAuth.Password)
 	}
 
-	res, err := client.Do(req)
+	res, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("cannot do request to Wallix bastion %s: %w", url, err)
+		return nil, 0, fmt.Errorf("cannot do request to Wallix bastion %s: %w", url, err)
 	}
 
 	if res.Body != nil {
@@ -59,74 +183,72 @@ func doRequest(
 
 	// Authentication successful, stop here
 	if res.StatusCode == http.StatusNoContent {
-		return body, nil
+		return body, res.StatusCode, nil
 	}
 
 	if res.StatusCode != http.StatusOK {
-		statusError := fmt.Errorf("response http status not ok: %d", res.StatusCode)
+		statusError := &StatusError{
+			StatusCode: res.StatusCode,
+			Body:       string(body),
+		}
 		responseError := APIError{}
-		if json.NewDecoder(res.Body).Decode(&responseError) == nil {
-			return body, fmt.Errorf("%w, api error response: %v", statusError, responseError)
+		if json.Unmarshal(body, &responseError) == nil {
+			statusError.APIError = &responseError
 		}
 
-		return body, fmt.Errorf("%w, plain text response: %s", statusError, string(body))
+		return body, res.StatusCode, statusError
 	}
 
-	return body, nil
+	return body, res.StatusCode, nil
 }
 
-func QuerySchemes(
-	client *http.Client, url string, params map[string]string,
-) (results []map[string]interface{}, err error) {
-	body, err := doRequest(
-		client,
+// Request a resource of the API and decode the json response into the result.
+// Decoding fails if a field has not the expected type.
+// If the session has expired, it authenticates again and retries once.
+func (c *Client) Query(ctx context.Context, path string, params map[string]string, result interface{}) (err error) {
+	session := c.currentSession()
+	body, err := c.doRequest(
+		ctx,
 		http.MethodGet,
-		url,
+		path,
 		params,
 		nil,
 	)
-	if err != nil {
-		return
-	}
-	reader := bytes.NewReader(body)
-	decoder := json.NewDecoder(reader)
-	if err := decoder.Decode(&results); err != nil {
-		return nil, fmt.Errorf("cannot decode response as json list %w: %s", err, string(body))
-	}
 
-	return
-}
-
-func QueryScheme(
-	client *http.Client, url string, params map[string]string,
-) (result map[string]interface{}, err error) {
-	body, err := doRequest(
-		client,
-		http.MethodGet,
-		url,
-		params,
-		nil,
-	)
+	var statusError *StatusError
+	if errors.As(err, &statusError) && statusError.StatusCode == http.StatusUnauthorized && c.Username != "" {
+		if err := c.renewSession(ctx, session); err != nil {
+			return err
+		}
+		session = c.currentSession()
+		body, err = c.doRequest(
+			ctx,
+			http.MethodGet,
+			path,
+			params,
+			nil,
+		)
+	}
 	if err != nil {
+		c.requestFailed(session, err)
+
 		return
 	}
 	reader := bytes.NewReader(body)
 	decoder := json.NewDecoder(reader)
-	if err := decoder.Decode(&result); err != nil {
-		return nil, fmt.Errorf("cannot decode response as json object %w: %s", err, string(body))
+	if err := decoder.Decode(result); err != nil {
+		return fmt.Errorf("cannot decode response of %s %w: %s", path, err, string(body))
 	}
 
 	return
 }
 
 // Authenticate on Wallix API to test or/and get cookie.
-func Authenticate(
-	client *http.Client, url string, user string, password string,
-) (err error) {
-	_, err = doRequest(
-		client,
+func (c *Client) Authenticate(ctx context.Context, user string, password string) (err error) {
+	_, err = c.doRequest(
+		ctx,
 		http.MethodPost,
-		url,
+		"",
 		nil,
 		&BasicAuth{
 			Username: user,
@@ -138,118 +260,131 @@ func Authenticate(
 }
 
 // Get users from /users API.
-func GetUsers(client *http.Client, url string) (users []map[string]interface{}, err error) {
-	users, err = QuerySchemes(
-		client,
-		url+"/users",
+func (c *Client) GetUsers(ctx context.Context) (users []User, err error) {
+	err = c.Query(
+		ctx,
+		"/users",
 		map[string]string{
 			"limit":  "-1",
 			"fields": "user_name",
 		},
+		&users,
 	)
 
 	return users, err
 }
 
 // Get groups from /usergroups API.
-func GetGroups(client *http.Client, url string) (groups []map[string]interface{}, err error) {
-	groups, err = QuerySchemes(
-		client,
-		url+"/usergroups",
+func (c *Client) GetGroups(ctx context.Context) (groups []Group, err error) {
+	err = c.Query(
+		ctx,
+		"/usergroups",
 		map[string]string{
 			"limit":  "-1",
 			"fields": "id",
 		},
+		&groups,
 	)
 
 	return groups, err
 }
 
 // Get devices from /devices API.
-func GetDevices(client *http.Client, url string) (devices []map[string]interface{}, err error) {
-	devices, err = QuerySchemes(
-		client,
-		url+"/devices",
+func (c *Client) GetDevices(ctx context.Context) (devices []Device, err error) {
+	err = c.Query(
+		ctx,
+		"/devices",
 		map[string]string{
 			"limit":  "-1",
 			"fields": "id",
 		},
+		&devices,
 	)
 
 	return devices, err
 }
 
-// Get closed sessions for last sessionsClosedMinutes minutes.
-func GetClosedSessions(
-	client *http.Client, url string, sessionsClosedMinutes int,
-) (sessionsClosed []map[string]interface{}, err error) {
-	fromDate := time.Now().Add(
-		-time.Minute * time.Duration(sessionsClosedMinutes),
-	).Format(TimeFormat)
-
-	sessionsClosed, err = QuerySchemes(
-		client,
-		url+"/sessions",
+// Get sessions closed since the from date from /sessions API.
+func (c *Client) GetClosedSessions(ctx context.Context, from time.Time) (sessionsClosed []Session, err error) {
+	err = c.Query(
+		ctx,
+		"/sessions",
 		map[string]string{
 			"limit":      "-1",
-			"fields":     "id",
+			"fields":     sessionsFields,
 			"date_field": "end",
 			"status":     "closed",
-			"from_date":  fromDate,
+			"from_date":  from.Format(TimeFormat),
 		},
+		&sessionsClosed,
 	)
 
 	return sessionsClosed, err
 }
 
 // Get current active sessions from /sessions API.
-
-func GetCurrentSessions(client *http.Client, url string) (sessionsCurrent []map[string]interface{}, err error) {
-	sessionsCurrent, err = QuerySchemes(
-		client,
-		url+"/sessions",
+func (c *Client) GetCurrentSessions(ctx context.Context) (sessionsCurrent []Session, err error) {
+	err = c.Query(
+		ctx,
+		"/sessions",
 		map[string]string{
 			"limit":  "-1",
-			"fields": "id",
+			"fields": sessionsFields,
 			"status": "current",
 		},
+		&sessionsCurrent,
 	)
 
 	return sessionsCurrent, err
 }
 
 // Get targets depdening on type from /targets API.
-func GetTargets(client *http.Client, url string, targetType string) (targets []map[string]interface{}, err error) {
-	targets, err = QuerySchemes(
-		client,
-		url+"/targets/"+targetType,
+func (c *Client) GetTargets(ctx context.Context, targetType string) (targets []Target, err error) {
+	err = c.Query(
+		ctx,
+		"/targets/"+targetType,
 		map[string]string{
 			"limit":  "-1",
 			"fields": "id",
 		},
+		&targets,
 	)
 
 	return targets, err
 }
 
 // Get encryption information from /encryption API.
-func GetEncryption(client *http.Client, url string) (encryption map[string]interface{}, err error) {
-	encryption, err = QueryScheme(
-		client,
-		url+"/encryption",
+func (c *Client) GetEncryption(ctx context.Context) (encryption Encryption, err error) {
+	err = c.Query(
+		ctx,
+		"/encryption",
 		nil,
+		&encryption,
 	)
 
 	return encryption, err
 }
 
 // Get license information from /licenseInfo API.
-func GetLicense(client *http.Client, url string) (license map[string]interface{}, err error) {
-	license, err = QueryScheme(
-		client,
-		url+"/licenseinfo",
+func (c *Client) GetLicense(ctx context.Context) (license License, err error) {
+	err = c.Query(
+		ctx,
+		"/licenseinfo",
 		nil,
+		&license,
 	)
 
 	return license, err
 }
+
+// Get versions of the API and the bastion from /version API.
+func (c *Client) GetVersion(ctx context.Context) (version Version, err error) {
+	err = c.Query(
+		ctx,
+		"/version",
+		nil,
+		&version,
+	)
+
+	return version, err
+}